@@ -8,11 +8,17 @@ import json
 This extension adds a context menu item to Nautilus for opening files in Google Drive.
 It generates a public link using rclone and opens it in the default web browser.
 
-The extension expects rclone to mount the drives at ~/google/$drive_name.
+The extension expects rclone to mount the drives at ~/google/$drive_name,
+or at ~/google/$profile/$drive for drives of a profile, see their env files.
 """
 
 class GoogleDriveOpener(GObject.GObject, Nautilus.MenuProvider):
     RCLONE_MOUNT_PATH = os.path.expanduser("~/google")
+    # adfinis-rclone-mgr writes the mountpoint of each drive of a profile in here
+    MOUNT_ENV_PATH = os.path.join(
+        os.environ.get("XDG_CONFIG_HOME") or os.path.expanduser("~/.config"),
+        "adfinis-rclone-mgr", "mounts",
+    )
 
     OPENDOCUMENT_FORMATS = [
         "application/vnd.oasis.opendocument.text",
@@ -52,12 +58,31 @@ class GoogleDriveOpener(GObject.GObject, Nautilus.MenuProvider):
 
         return items
 
-    def _get_rclone_file(self, file_path):
-        try:
+    def _find_drive(self, file_path):
+        """Returns the remote of the file and the path of the file in it."""
+        file_path = os.path.abspath(file_path)
+        drive_name, mount_dir = None, ""
+        if os.path.isdir(self.MOUNT_ENV_PATH):
+            for env_file in os.listdir(self.MOUNT_ENV_PATH):
+                if not env_file.endswith(".env"):
+                    continue
+                with open(os.path.join(self.MOUNT_ENV_PATH, env_file)) as f:
+                    for line in f:
+                        key, _, value = line.strip().partition("=")
+                        # the longest match wins, a profile directory contains the mountpoints of its drives
+                        if key == "MOUNT_DIR" and (file_path + os.sep).startswith(value + os.sep) and len(value) > len(mount_dir):
+                            drive_name, mount_dir = env_file[:-len(".env")], value
+        if drive_name is None:
             relative_path = os.path.relpath(file_path, self.RCLONE_MOUNT_PATH)
             drive_name = relative_path.split(os.sep)[0]
-            # remove drive_name and the last part of the path
-            file_path = os.path.join("", *relative_path.split(os.sep)[1:-1])
+            mount_dir = os.path.join(self.RCLONE_MOUNT_PATH, drive_name)
+        return drive_name, os.path.relpath(file_path, mount_dir)
+
+    def _get_rclone_file(self, file_path):
+        try:
+            drive_name, relative_path = self._find_drive(file_path)
+            # remove the last part of the path
+            file_path = os.path.join("", *relative_path.split(os.sep)[:-1])
             file_name = os.path.basename(relative_path)
 
             cmd = ['rclone', 'lsjson', f'{drive_name}:{file_path}']
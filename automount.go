@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultNetworkTimeout = 2 * time.Minute
+	defaultRetryWindow    = 10 * time.Minute
+	defaultConcurrency    = 3
+	defaultSpacing        = 2 * time.Second
+	automountMinBackoff   = 5 * time.Second
+	automountMaxBackoff   = 2 * time.Minute
+	// googleAddr is what rclone needs to reach for every mount
+	googleAddr = "www.googleapis.com:443"
+)
+
+// withDefaults fills in the defaults for unset values.
+func (c automountConfig) withDefaults() automountConfig {
+	if c.NetworkTimeout <= 0 {
+		c.NetworkTimeout = defaultNetworkTimeout
+	}
+	if c.RetryWindow <= 0 {
+		c.RetryWindow = defaultRetryWindow
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = defaultConcurrency
+	}
+	if c.Spacing <= 0 {
+		c.Spacing = defaultSpacing
+	}
+	if len(c.Priority) == 0 {
+		c.Priority = []string{sanitizeDriveName("My Drive")}
+	}
+	return c
+}
+
+// orderDrives sorts the drives by priority, drives without a priority come last in alphabetical order.
+func orderDrives(drives, priority []string) []string {
+	ordered := slices.Clone(drives)
+	rank := func(name string) int {
+		if i := slices.Index(priority, name); i >= 0 {
+			return i
+		}
+		return len(priority)
+	}
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra - rb
+		}
+		return strings.Compare(a, b)
+	})
+	return ordered
+}
+
+// automountOrchestrator starts drives with limited concurrency and some spacing between them.
+// Starting 30 shared drives at once triggers the rate limits of the Drive API.
+type automountOrchestrator struct {
+	start    func(ctx context.Context, name string) error
+	spacing  time.Duration
+	deadline time.Time
+	backoff  func(retry int) time.Duration
+	// onRetry is called with the time of the next attempt after a failed start
+	onRetry func(name string, at time.Time)
+
+	slots chan struct{}
+	mu    sync.Mutex
+	next  time.Time
+}
+
+func newAutomountOrchestrator(sm serviceManager, ac automountConfig, deadline time.Time) *automountOrchestrator {
+	return &automountOrchestrator{
+		start: func(ctx context.Context, name string) error {
+			// rclone@.service only checks that the mountpoint exists, like mountDrives it's created here
+			if err := ensureFolderExists(getDriveDataPath(name)); err != nil {
+				return fmt.Errorf("failed to create mount path: %w", err)
+			}
+			return startService(ctx, sm, name)
+		},
+		spacing:  ac.Spacing,
+		deadline: deadline,
+		backoff:  automountBackoff,
+		onRetry:  func(string, time.Time) {},
+		slots:    make(chan struct{}, ac.Concurrency),
+	}
+}
+
+// acquire takes a slot and waits until the spacing to the previous start is over.
+func (o *automountOrchestrator) acquire(ctx context.Context) error {
+	select {
+	case o.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	o.mu.Lock()
+	now := time.Now()
+	at := now
+	if o.next.After(now) {
+		at = o.next
+	}
+	o.next = at.Add(o.spacing)
+	o.mu.Unlock()
+
+	select {
+	case <-time.After(at.Sub(now)):
+		return nil
+	case <-ctx.Done():
+		o.release()
+		return ctx.Err()
+	}
+}
+
+func (o *automountOrchestrator) release() {
+	<-o.slots
+}
+
+// run starts the drives in the given order and waits until all of them are mounted or given up on.
+func (o *automountOrchestrator) run(ctx context.Context, drives []string) map[string]error {
+	var mu sync.Mutex
+	results := map[string]error{}
+	setResult := func(name string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[name] = err
+	}
+	var wg sync.WaitGroup
+	for _, name := range drives {
+		// the first attempts are taken in order, retries compete for the slots
+		if err := o.acquire(ctx); err != nil {
+			// the started drives are still writing their results
+			setResult(name, err)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			first := true
+			err := startWithRetry(ctx, name, func(ctx context.Context) error {
+				if !first {
+					if err := o.acquire(ctx); err != nil {
+						return err
+					}
+				}
+				first = false
+				defer o.release()
+				return o.start(ctx, name)
+			}, o.deadline, o.backoff, func(at time.Time) { o.onRetry(name, at) })
+			setResult(name, err)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// canReachGoogle checks whether a connection to the Google APIs can be established.
+// NetworkManager might report full connectivity before DNS or the VPN are ready, so we check ourselves.
+func canReachGoogle(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", googleAddr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// waitForConnectivity polls check until it succeeds or timeout is over.
+func waitForConnectivity(ctx context.Context, timeout, interval time.Duration, check func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := check(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("no connectivity after %s: %w", timeout, err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// automountBackoff returns the delay before the given retry, starting with 0.
+func automountBackoff(retry int) time.Duration {
+	backoff := automountMinBackoff
+	for range retry {
+		backoff *= 2
+		if backoff >= automountMaxBackoff {
+			return automountMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// startWithRetry calls start and retries with an exponential backoff until deadline.
+// next is called with the time of the next attempt after every failure.
+func startWithRetry(ctx context.Context, name string, start func(ctx context.Context) error, deadline time.Time, backoff func(retry int) time.Duration, next func(at time.Time)) error {
+	for retry := 0; ; retry++ {
+		err := start(ctx)
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		if err == nil {
+			return nil
+		}
+		at := time.Now().Add(backoff(retry))
+		if at.After(deadline) {
+			return fmt.Errorf("giving up on %q: %w", name, err)
+		}
+		log.Printf("Failed to mount %q, retrying at %s: %v", name, at.Format(time.TimeOnly), err)
+		next(at)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(at)):
+		}
+	}
+}
+
+// enabledDrives returns the drives that should be mounted automatically.
+func enabledDrives(ctx context.Context, sm serviceManager) ([]string, error) {
+	var drives []string
+	var errs []error
+	for _, name := range getRemotes() {
+		enabled, err := isServiceEnabled(ctx, sm, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if enabled {
+			drives = append(drives, name)
+		}
+	}
+	return drives, errors.Join(errs...)
+}
+
+// migrateDefaultTargetLinks re-enables drives that were enabled before they moved to the automount target.
+// Otherwise systemd keeps starting them at login, before the network is up.
+func migrateDefaultTargetLinks(ctx context.Context, sm serviceManager, drives []string) {
+	for _, name := range drives {
+		link := path.Join(getUserUnitDir(), "default.target.wants", driveNameToUnitName(name))
+		if _, err := os.Lstat(link); err != nil {
+			continue
+		}
+		log.Printf("Moving %q to %s", name, automountTargetName)
+		if err := disableService(ctx, sm, name); err != nil {
+			log.Println(err)
+			continue
+		}
+		if err := enableService(ctx, sm, name); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func setAutomountWaiting(drives []string) error {
+	return updateState(func(s *managerState) error {
+		s.Automount.Waiting = drives
+		return nil
+	})
+}
+
+func setAutomountRetrying(name string, at time.Time) error {
+	return updateState(func(s *managerState) error {
+		if at.IsZero() {
+			delete(s.Automount.Retrying, name)
+			return nil
+		}
+		if s.Automount.Retrying == nil {
+			s.Automount.Retrying = map[string]time.Time{}
+		}
+		s.Automount.Retrying[name] = at
+		return nil
+	})
+}
+
+// runAutomount starts the enabled drives once after login.
+// The drives aren't started by systemd, so they don't fail before the network is up.
+func (d *mgrDaemon) runAutomount(ctx context.Context) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	ac := cfg.Automount.withDefaults()
+	deadline := time.Now().Add(ac.RetryWindow)
+
+	drives, err := enabledDrives(ctx, d.sm)
+	if err != nil {
+		log.Println(err)
+	}
+	if len(drives) > 0 {
+		if err := d.sm.Reload(ctx); err != nil {
+			log.Println(err)
+		}
+		migrateDefaultTargetLinks(ctx, d.sm, drives)
+	}
+	// the daemon might have been restarted, leave running mounts alone
+	active, err := activeDrives(ctx, d.sm)
+	if err != nil {
+		return err
+	}
+	drives = slices.DeleteFunc(drives, func(name string) bool { return slices.Contains(active, name) })
+	if len(drives) == 0 {
+		return nil
+	}
+
+	if err := setAutomountWaiting(drives); err != nil {
+		log.Println(err)
+	}
+	log.Printf("Waiting for the network to mount %v", drives)
+	if err := waitForConnectivity(ctx, ac.NetworkTimeout, 2*time.Second, canReachGoogle); err != nil {
+		// mount anyway, failed mounts are retried
+		log.Println(err)
+	}
+	if err := setAutomountWaiting(nil); err != nil {
+		log.Println(err)
+	}
+
+	o := newAutomountOrchestrator(d.sm, ac, deadline)
+	o.onRetry = func(name string, at time.Time) {
+		if err := setAutomountRetrying(name, at); err != nil {
+			log.Println(err)
+		}
+	}
+	for name, err := range o.run(ctx, orderDrives(drives, ac.Priority)) {
+		if err := setAutomountRetrying(name, time.Time{}); err != nil {
+			log.Println(err)
+		}
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		log.Printf("Mounted %q", name)
+	}
+	return nil
+}
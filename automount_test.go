@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutomountBackoff(t *testing.T) {
+	assert.Equal(t, 5*time.Second, automountBackoff(0))
+	assert.Equal(t, 10*time.Second, automountBackoff(1))
+	assert.Equal(t, 80*time.Second, automountBackoff(4))
+	assert.Equal(t, automountMaxBackoff, automountBackoff(5))
+	assert.Equal(t, automountMaxBackoff, automountBackoff(100))
+}
+
+func TestWaitForConnectivity(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	err := waitForConnectivity(ctx, time.Second, time.Millisecond, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("no route to host")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	err = waitForConnectivity(ctx, 20*time.Millisecond, time.Millisecond, func(context.Context) error {
+		return errors.New("no route to host")
+	})
+	assert.ErrorContains(t, err, "no route to host")
+}
+
+func TestStartWithRetry(t *testing.T) {
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	sm.setJobResult("start", "rclone@My_Drive.service", "failed")
+	backoff := func(int) time.Duration { return 10 * time.Millisecond }
+
+	var retries []time.Time
+	done := make(chan error)
+	go func() {
+		start := func(ctx context.Context) error { return startService(ctx, sm, "My_Drive") }
+		done <- startWithRetry(ctx, "My_Drive", start, time.Now().Add(time.Minute), backoff, func(at time.Time) {
+			retries = append(retries, at)
+		})
+	}()
+	assert.Eventually(t, func() bool {
+		return sm.jobCount("start", "rclone@My_Drive.service") >= 3
+	}, time.Second, time.Millisecond)
+	// the network is back
+	sm.setJobResult("start", "rclone@My_Drive.service", "done")
+	assert.NoError(t, <-done)
+	assert.GreaterOrEqual(t, len(retries), 2)
+	active, _ := sm.state("rclone@My_Drive.service")
+	assert.Equal(t, "active", active)
+
+	// no retries after the deadline
+	sm.setJobResult("start", "rclone@Broken.service", "failed")
+	start := func(ctx context.Context) error { return startService(ctx, sm, "Broken") }
+	err := startWithRetry(ctx, "Broken", start, time.Now(), backoff, func(time.Time) {})
+	assert.ErrorContains(t, err, `giving up on "Broken"`)
+	assert.Equal(t, 1, sm.jobCount("start", "rclone@Broken.service"))
+}
+
+func TestListServiceStatusesAutomount(t *testing.T) {
+	useTempDirs(t)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	assert.NoError(t, setAutomountWaiting([]string{"Waiting"}))
+	assert.NoError(t, setAutomountRetrying("Retrying", time.Now().Add(time.Minute)))
+
+	statuses, err := listServiceStatuses(ctx, sm, []string{"Waiting", "Retrying", "Other"})
+	assert.NoError(t, err)
+	assert.Equal(t, "waiting for network", statuses[0].Status)
+	assert.Equal(t, "retrying", statuses[1].Status)
+	assert.Equal(t, "inactive", statuses[2].Status)
+}
+
+func TestOrderDrives(t *testing.T) {
+	drives := []string{"b_shared", "My_Drive", "a_shared", "shared_with_me"}
+	assert.Equal(t, []string{"My_Drive", "shared_with_me", "a_shared", "b_shared"}, orderDrives(drives, []string{"My_Drive", "shared_with_me", "missing"}))
+	assert.Equal(t, []string{"My_Drive", "a_shared", "b_shared", "shared_with_me"}, orderDrives(drives, nil))
+}
+
+func TestAutomountOrchestrator(t *testing.T) {
+	drives := []string{"My_Drive", "a", "b", "c", "d", "e"}
+	o := newAutomountOrchestrator(nil, automountConfig{Concurrency: 2, Spacing: 5 * time.Millisecond}, time.Now().Add(time.Minute))
+	o.backoff = func(int) time.Duration { return time.Millisecond }
+
+	var mu sync.Mutex
+	var order []string
+	running, maxRunning := 0, 0
+	var starts []time.Time
+	failedOnce := false
+	o.start = func(ctx context.Context, name string) error {
+		mu.Lock()
+		order = append(order, name)
+		starts = append(starts, time.Now())
+		running++
+		maxRunning = max(maxRunning, running)
+		fail := name == "c" && !failedOnce
+		failedOnce = failedOnce || fail
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if fail {
+			return errors.New("rate limit exceeded")
+		}
+		return nil
+	}
+
+	results := o.run(context.Background(), drives)
+	for _, name := range drives {
+		assert.NoError(t, results[name], name)
+	}
+	// the first attempts are in order, c is started twice
+	assert.Equal(t, drives, lo.Uniq(order))
+	assert.Len(t, order, len(drives)+1)
+	assert.Equal(t, 2, maxRunning)
+	for i := 1; i < len(starts); i++ {
+		assert.GreaterOrEqual(t, starts[i].Sub(starts[i-1]), 4*time.Millisecond)
+	}
+}
+
+func TestAutomountCreatesMountpoint(t *testing.T) {
+	useTempDirs(t)
+	sm := newFakeServiceManager()
+	o := newAutomountOrchestrator(sm, automountConfig{Concurrency: 1}, time.Now().Add(time.Minute))
+
+	assert.NoError(t, o.start(context.Background(), "My_Drive"))
+	assert.DirExists(t, getDriveDataPath("My_Drive"))
+	assert.Equal(t, 1, sm.jobCount("start", "rclone@My_Drive.service"))
+}
+
+func TestAutomountOrchestratorCancel(t *testing.T) {
+	drives := []string{"a", "b", "c", "d"}
+	o := newAutomountOrchestrator(nil, automountConfig{Concurrency: 2}, time.Now().Add(time.Minute))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{}, len(drives))
+	o.start = func(ctx context.Context, name string) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	go func() {
+		// a and b hold the slots, c and d are still waiting for one
+		<-started
+		<-started
+		cancel()
+	}()
+
+	// run with -race, the waiting drives give up while the started ones write their results
+	results := o.run(ctx, drives)
+	assert.Len(t, results, len(drives))
+	for _, name := range drives {
+		assert.ErrorIs(t, results[name], context.Canceled, name)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+const bandwidthSchedulerInterval = 30 * time.Second
+
+// pausedUploadRate is used to pause uploads, rclone can't stop them completely without stopping the mount.
+const pausedUploadRate = fs.SizeSuffix(1024)
+
+func validateBandwidthRate(rate string) error {
+	var bw fs.BwPair
+	if err := bw.Set(rate); err != nil {
+		return fmt.Errorf("invalid bandwidth rate %q: %w", rate, err)
+	}
+	return nil
+}
+
+func validateBandwidthSchedule(schedule string) error {
+	var tt fs.BwTimetable
+	if err := tt.Set(schedule); err != nil {
+		return fmt.Errorf("invalid bandwidth schedule %q: %w", schedule, err)
+	}
+	return nil
+}
+
+// sameBandwidth compares two rates semantically, rclone reports "512k" as "512Ki" for example.
+func sameBandwidth(a, b string) bool {
+	var bwA, bwB fs.BwPair
+	if err := bwA.Set(a); err != nil {
+		return false
+	}
+	if err := bwB.Set(b); err != nil {
+		return false
+	}
+	// anything below zero means off
+	return max(bwA.Tx, -1) == max(bwB.Tx, -1) && max(bwA.Rx, -1) == max(bwB.Rx, -1)
+}
+
+// activeBandwidthOverride returns the override for a drive, overrides for a specific drive win over "all".
+func activeBandwidthOverride(state *managerState, driveName string, now time.Time) (bandwidthOverride, bool) {
+	for _, key := range []string{driveName, "all"} {
+		if o, ok := state.BandwidthOverrides[key]; ok && o.activeAt(now) {
+			return o, true
+		}
+	}
+	return bandwidthOverride{}, false
+}
+
+// effectiveBandwidthLimit returns the rate that should currently apply to a drive.
+// Temporary overrides take precedence over the configured schedule, without either there is no limit.
+// On metered connections uploads are paused on top of that, if configured.
+func effectiveBandwidthLimit(cfg *managerConfig, state *managerState, driveName string, now time.Time) (string, error) {
+	var bw fs.BwPair
+	if o, ok := activeBandwidthOverride(state, driveName, now); ok {
+		if err := bw.Set(o.Rate); err != nil {
+			return "", fmt.Errorf("invalid bandwidth override of %q: %w", driveName, err)
+		}
+	} else if schedule := cfg.drive(driveName).BandwidthSchedule; schedule != "" {
+		var tt fs.BwTimetable
+		if err := tt.Set(schedule); err != nil {
+			return "", fmt.Errorf("invalid bandwidth schedule of %q: %w", driveName, err)
+		}
+		bw = tt.LimitAt(now).Bandwidth
+	} else {
+		bw = fs.BwPair{Tx: -1, Rx: -1}
+	}
+
+	if state.Network.Metered && cfg.Network.PauseUploadsOnMetered {
+		if bw.Tx <= 0 || bw.Tx > pausedUploadRate {
+			bw.Tx = pausedUploadRate
+		}
+	}
+	return bw.String(), nil
+}
+
+func getBandwidthLimit(ctx context.Context, driveName string) (string, error) {
+	var out struct {
+		Rate string `json:"rate"`
+	}
+	if err := rcCall(ctx, driveName, "core/bwlimit", nil, &out); err != nil {
+		return "", err
+	}
+	return out.Rate, nil
+}
+
+func setBandwidthLimit(ctx context.Context, driveName, rate string) error {
+	return rcCall(ctx, driveName, "core/bwlimit", map[string]string{"rate": rate}, nil)
+}
+
+// applyBandwidthLimits makes sure every running mount uses its effective bandwidth limit.
+// Mounts lose their limit when they get restarted, so the current limit is always queried first.
+func applyBandwidthLimits(ctx context.Context, sm serviceManager) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	state, err := loadState()
+	if err != nil {
+		return err
+	}
+	drives, err := activeDrives(ctx, sm)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var errs []error
+	for _, name := range drives {
+		want, err := effectiveBandwidthLimit(cfg, state, name, now)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		current, err := getBandwidthLimit(ctx, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if sameBandwidth(current, want) {
+			continue
+		}
+		if err := setBandwidthLimit(ctx, name, want); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("Set bandwidth limit of %q to %s", name, want)
+	}
+	return joinErrors("Error while applying bandwidth limits", errs)
+}
+
+// pruneBandwidthOverrides removes expired overrides from the state.
+func pruneBandwidthOverrides(now time.Time) error {
+	return updateState(func(s *managerState) error {
+		for key, o := range s.BandwidthOverrides {
+			if !o.activeAt(now) {
+				delete(s.BandwidthOverrides, key)
+			}
+		}
+		return nil
+	})
+}
+
+func (d *mgrDaemon) runBandwidthScheduler(ctx context.Context) error {
+	ticker := time.NewTicker(bandwidthSchedulerInterval)
+	defer ticker.Stop()
+	for {
+		if err := pruneBandwidthOverrides(time.Now()); err != nil {
+			log.Printf("Failed to prune bandwidth overrides: %v", err)
+		}
+		if err := applyBandwidthLimits(ctx, d.sm); err != nil {
+			log.Println(err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func bandwidthSet(cmd *cobra.Command, args []string) {
+	rate := args[0]
+	if err := validateBandwidthRate(rate); err != nil {
+		log.Fatalln(err)
+	}
+	drives := args[1:]
+	if len(drives) == 0 || lo.Contains(drives, "all") {
+		drives = []string{"all"}
+	}
+
+	override := bandwidthOverride{Rate: rate}
+	if bandwidthSetCmdFlags.Duration > 0 {
+		override.Until = time.Now().Add(bandwidthSetCmdFlags.Duration)
+	}
+	err := updateState(func(s *managerState) error {
+		if s.BandwidthOverrides == nil {
+			s.BandwidthOverrides = map[string]bandwidthOverride{}
+		}
+		for _, drive := range drives {
+			s.BandwidthOverrides[drive] = override
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalln("Failed to save bandwidth override:", err)
+	}
+	for _, drive := range drives {
+		if override.Until.IsZero() {
+			log.Printf("Limited bandwidth of %q to %s until reset", drive, rate)
+		} else {
+			log.Printf("Limited bandwidth of %q to %s until %s", drive, rate, override.Until.Format(time.DateTime))
+		}
+	}
+	applyBandwidthLimitsNow(cmd.Context())
+}
+
+func bandwidthReset(cmd *cobra.Command, args []string) {
+	err := updateState(func(s *managerState) error {
+		if len(args) == 0 || lo.Contains(args, "all") {
+			s.BandwidthOverrides = nil
+			return nil
+		}
+		for _, drive := range args {
+			delete(s.BandwidthOverrides, drive)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalln("Failed to reset bandwidth overrides:", err)
+	}
+	log.Println("Removed bandwidth overrides")
+	applyBandwidthLimitsNow(cmd.Context())
+}
+
+func bandwidthSchedule(cmd *cobra.Command, args []string) {
+	driveName := args[0]
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalln("Failed to load config:", err)
+	}
+	dc := cfg.drive(driveName)
+
+	switch {
+	case bandwidthScheduleCmdFlags.Clear:
+		dc.BandwidthSchedule = ""
+	case len(args) == 2:
+		if err := validateBandwidthSchedule(args[1]); err != nil {
+			log.Fatalln(err)
+		}
+		dc.BandwidthSchedule = args[1]
+	default:
+		if dc.BandwidthSchedule == "" {
+			fmt.Printf("%s: no bandwidth schedule\n", driveName)
+		} else {
+			fmt.Printf("%s: %s\n", driveName, dc.BandwidthSchedule)
+		}
+		return
+	}
+
+	cfg.setDrive(driveName, dc)
+	if err := cfg.save(); err != nil {
+		log.Fatalln("Failed to save config:", err)
+	}
+	log.Printf("Updated bandwidth schedule of %q", driveName)
+	applyBandwidthLimitsNow(cmd.Context())
+}
+
+// applyBandwidthLimitsNow applies changed limits right away instead of waiting for the daemon.
+func applyBandwidthLimitsNow(ctx context.Context) {
+	sm, err := newServiceManager(ctx)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer sm.Close()
+	if err := applyBandwidthLimits(ctx, sm); err != nil {
+		log.Println(err)
+	}
+}
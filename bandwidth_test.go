@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSameBandwidth(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected bool
+	}{
+		{"512k", "512Ki", true},
+		{"1M", "1024k", true},
+		{"off", "off", true},
+		{"1M:off", "1M:off", true},
+		{"1M", "1M:off", false},
+		{"1M", "off", false},
+		{"invalid", "1M", false},
+	} {
+		assert.Equal(t, test.expected, sameBandwidth(test.a, test.b), "%s == %s", test.a, test.b)
+	}
+}
+
+func TestEffectiveBandwidthLimit(t *testing.T) {
+	// a monday
+	morning := time.Date(2025, 6, 2, 9, 0, 0, 0, time.Local)
+	evening := time.Date(2025, 6, 2, 19, 0, 0, 0, time.Local)
+
+	cfg := &managerConfig{Drives: map[string]driveConfig{
+		"My_Drive": {BandwidthSchedule: "08:00,512k 18:00,off"},
+		"Broken":   {BandwidthSchedule: "not a schedule"},
+	}}
+
+	for _, test := range []struct {
+		name     string
+		state    *managerState
+		drive    string
+		now      time.Time
+		expected string
+		err      bool
+	}{
+		{
+			name:     "no schedule",
+			state:    &managerState{},
+			drive:    "Other",
+			now:      morning,
+			expected: "off",
+		},
+		{
+			name:     "schedule during the day",
+			state:    &managerState{},
+			drive:    "My_Drive",
+			now:      morning,
+			expected: "512Ki",
+		},
+		{
+			name:     "schedule in the evening",
+			state:    &managerState{},
+			drive:    "My_Drive",
+			now:      evening,
+			expected: "off",
+		},
+		{
+			name: "override for all drives",
+			state: &managerState{BandwidthOverrides: map[string]bandwidthOverride{
+				"all": {Rate: "1M", Until: morning.Add(time.Hour)},
+			}},
+			drive:    "My_Drive",
+			now:      morning,
+			expected: "1Mi",
+		},
+		{
+			name: "drive override wins over all",
+			state: &managerState{BandwidthOverrides: map[string]bandwidthOverride{
+				"all":      {Rate: "1M"},
+				"My_Drive": {Rate: "2M"},
+			}},
+			drive:    "My_Drive",
+			now:      morning,
+			expected: "2Mi",
+		},
+		{
+			name: "expired override",
+			state: &managerState{BandwidthOverrides: map[string]bandwidthOverride{
+				"all": {Rate: "1M", Until: morning.Add(-time.Minute)},
+			}},
+			drive:    "My_Drive",
+			now:      morning,
+			expected: "512Ki",
+		},
+		{
+			name:  "invalid schedule",
+			state: &managerState{},
+			drive: "Broken",
+			now:   morning,
+			err:   true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			limit, err := effectiveBandwidthLimit(cfg, test.state, test.drive, test.now)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, limit)
+		})
+	}
+}
+
+func TestValidateBandwidth(t *testing.T) {
+	assert.NoError(t, validateBandwidthRate("1M"))
+	assert.NoError(t, validateBandwidthRate("512k:off"))
+	assert.Error(t, validateBandwidthRate("fast"))
+
+	assert.NoError(t, validateBandwidthSchedule("08:00,512k 18:00,off"))
+	assert.Error(t, validateBandwidthSchedule("25:00,1M"))
+}
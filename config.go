@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/adrg/xdg"
+	"gopkg.in/yaml.v3"
+)
+
+// managerConfig holds the settings of adfinis-rclone-mgr itself.
+// Everything rclone needs to know lives in rclone.conf, this is only about how we manage the mounts.
+type managerConfig struct {
+	Network   networkConfig          `yaml:"network,omitempty"`
+	Automount automountConfig        `yaml:"automount,omitempty"`
+	Watchdog  watchdogConfig         `yaml:"watchdog,omitempty"`
+	Drives    map[string]driveConfig `yaml:"drives,omitempty"`
+	// LocalNames are the names chosen for drives instead of their name in Google Drive, keyed by drive ID
+	LocalNames map[string]string `yaml:"local_names,omitempty"`
+	// Profiles are the named profiles gdrive-config was run with, each one is another Google account
+	Profiles []string `yaml:"profiles,omitempty"`
+}
+
+type networkConfig struct {
+	// PauseUploadsOnMetered throttles uploads to a trickle while on a metered connection, e.g. when tethering
+	PauseUploadsOnMetered bool `yaml:"pause_uploads_on_metered,omitempty"`
+}
+
+// automountConfig controls how the daemon starts the enabled drives after login, zero values use the defaults.
+type automountConfig struct {
+	// NetworkTimeout is how long to wait for Google to be reachable before mounting anyway
+	NetworkTimeout time.Duration `yaml:"network_timeout,omitempty"`
+	// RetryWindow is how long failed mounts are retried after login
+	RetryWindow time.Duration `yaml:"retry_window,omitempty"`
+	// Concurrency is the number of drives mounted at the same time
+	Concurrency int `yaml:"concurrency,omitempty"`
+	// Spacing is the minimum time between starting two mounts
+	Spacing time.Duration `yaml:"spacing,omitempty"`
+	// Priority are the drives mounted first, in this order
+	Priority []string `yaml:"priority,omitempty"`
+}
+
+// watchdogConfig tunes the hung mount detection of the daemon, zero values use the defaults.
+type watchdogConfig struct {
+	// Interval between two checks of a mount
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Timeout after which a check counts as failed
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Failures is the number of failed checks in a row after which a mount is unhealthy
+	Failures int `yaml:"failures,omitempty"`
+	// AutoRestart force unmounts and restarts unhealthy mounts
+	AutoRestart bool `yaml:"auto_restart,omitempty"`
+}
+
+// driveConfig holds the settings for a single drive, keyed by its remote name.
+type driveConfig struct {
+	// BandwidthSchedule is an rclone bandwidth timetable, e.g. "08:00,512k 18:00,off"
+	BandwidthSchedule string `yaml:"bandwidth_schedule,omitempty"`
+	// IdleTimeout unmounts the drive after it wasn't used for this long, it's mounted again when the folder is opened
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"`
+}
+
+func getConfigPath() string {
+	return path.Join(xdg.ConfigHome, "adfinis-rclone-mgr", "config.yaml")
+}
+
+func loadConfig() (*managerConfig, error) {
+	return readConfig(getConfigPath())
+}
+
+func readConfig(configPath string) (*managerConfig, error) {
+	cfg := &managerConfig{}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config %s: %w", configPath, err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", configPath, err)
+	}
+	return cfg, nil
+}
+
+func (c *managerConfig) save() error {
+	return c.write(getConfigPath())
+}
+
+func (c *managerConfig) write(configPath string) error {
+	if err := ensureFolderExists(path.Dir(configPath)); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := os.WriteFile(configPath, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write config %s: %w", configPath, err)
+	}
+	return nil
+}
+
+// drive returns the settings of a drive, or the defaults if the drive has none.
+func (c *managerConfig) drive(name string) driveConfig {
+	return c.Drives[name]
+}
+
+// renameDrive moves the settings of a drive to its new name.
+func (c *managerConfig) renameDrive(from, to string) {
+	if dc, ok := c.Drives[from]; ok {
+		c.setDrive(to, dc)
+		delete(c.Drives, from)
+	}
+	for i, name := range c.Automount.Priority {
+		if name == from {
+			c.Automount.Priority[i] = to
+		}
+	}
+}
+
+func (c *managerConfig) setDrive(name string, dc driveConfig) {
+	if c.Drives == nil {
+		c.Drives = map[string]driveConfig{}
+	}
+	if dc == (driveConfig{}) {
+		delete(c.Drives, name)
+		return
+	}
+	c.Drives[name] = dc
+}
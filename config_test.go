@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigReadWrite(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "adfinis-rclone-mgr", "config.yaml")
+
+	// a missing config is an empty config
+	cfg, err := readConfig(configPath)
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Drives)
+
+	cfg.setDrive("My_Drive", driveConfig{BandwidthSchedule: "08:00,512k 18:00,off"})
+	assert.NoError(t, cfg.write(configPath))
+
+	cfg, err = readConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "08:00,512k 18:00,off", cfg.drive("My_Drive").BandwidthSchedule)
+
+	// empty drive configs are removed
+	cfg.setDrive("My_Drive", driveConfig{})
+	assert.NotContains(t, cfg.Drives, "My_Drive")
+}
+
+func TestStateUpdate(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "adfinis-rclone-mgr", "state.json")
+	until := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+
+	err := updateStateAt(statePath, func(s *managerState) error {
+		s.BandwidthOverrides = map[string]bandwidthOverride{"all": {Rate: "1M", Until: until}}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	state, err := readState(statePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "1M", state.BandwidthOverrides["all"].Rate)
+	assert.True(t, until.Equal(state.BandwidthOverrides["all"].Until))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// mgrDaemon is the long running per user process started by adfinis-rclone-mgr.service.
+// It runs components that need to keep an eye on all mounts, e.g. the bandwidth scheduler or the network watcher.
+type mgrDaemon struct {
+	sm serviceManager
+}
+
+type daemonComponent struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+func (d *mgrDaemon) components() []daemonComponent {
+	return []daemonComponent{
+		{name: "bandwidth scheduler", run: d.runBandwidthScheduler},
+		{name: "network watcher", run: d.runNetworkWatcher},
+		{name: "sleep watcher", run: d.runSleepWatcher},
+		{name: "watchdog", run: d.runWatchdog},
+		{name: "automount", run: d.runAutomount},
+		{name: "idle unmount", run: d.runIdleUnmount},
+	}
+}
+
+func runDaemon(cmd *cobra.Command, _ []string) {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sm, err := newServiceManager(ctx)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer sm.Close()
+
+	d := &mgrDaemon{sm: sm}
+	warnOutdatedUnits()
+
+	d.run(ctx)
+	log.Println("Daemon stopped")
+}
+
+// run starts all components and waits for them after ctx is done.
+func (d *mgrDaemon) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, c := range d.components() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Printf("Starting %s", c.name)
+			if err := c.run(ctx); err != nil {
+				log.Printf("The %s stopped: %v", c.name, err)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
+)
+
+// discovery is what changed since the user was last told about their drives.
+type discovery struct {
+	// New are shared drives without a remote the user doesn't know about yet
+	New []models.Drive
+	// Lost are remotes of drives the user has no access to anymore
+	Lost []string
+}
+
+// isSharedDrive reports whether a drive is a shared drive, My Drive and Shared With Me are always there.
+func isSharedDrive(d models.Drive) bool {
+	return d.ID != "my_drive" && d.ID != "shared_with_me"
+}
+
+// discoverChanges compares the drives and remotes with what the user was told before.
+// managed are the remotes gdrive-config created, the drives need their remotes set.
+func discoverChanges(drives []models.Drive, managed []string, seen discoveryState) discovery {
+	var found discovery
+	for _, d := range drives {
+		if isSharedDrive(d) && d.Remote == "" && !slices.Contains(seen.KnownDrives, d.ID) {
+			found.New = append(found.New, d)
+		}
+	}
+	for _, name := range orphanedRemotes(managed, drives) {
+		if !slices.Contains(seen.LostRemotes, name) {
+			found.Lost = append(found.Lost, name)
+		}
+	}
+	return found
+}
+
+func driveIDs(drives []models.Drive) []string {
+	ids := make([]string, 0, len(drives))
+	for _, d := range drives {
+		if d.ID != "" {
+			ids = append(ids, d.ID)
+		}
+	}
+	return ids
+}
+
+// rememberDrives marks the drives of the active profile as known, so discover doesn't ask about them.
+// gdrive-config calls it for all drives it showed.
+func rememberDrives(drives []models.Drive) error {
+	return updateState(func(s *managerState) error {
+		seen := s.discovery(activeProfile)
+		for _, id := range driveIDs(drives) {
+			if !slices.Contains(seen.KnownDrives, id) {
+				seen.KnownDrives = append(seen.KnownDrives, id)
+			}
+		}
+		s.setDiscovery(activeProfile, seen)
+		return nil
+	})
+}
+
+func printDiscovery(out io.Writer, found discovery) {
+	if len(found.New) == 0 && len(found.Lost) == 0 {
+		fmt.Fprintln(out, "Nothing new")
+		return
+	}
+	if len(found.New) > 0 {
+		fmt.Fprintln(out, "New drives:")
+		for _, d := range found.New {
+			fmt.Fprintf(out, "- %s (%s)\n", d.Name, d.ID)
+		}
+		fmt.Fprintf(out, "Add them with 'adfinis-rclone-mgr gdrive-config%s'\n", profileFlag(activeProfile))
+	}
+	if len(found.Lost) > 0 {
+		fmt.Fprintln(out, "No access anymore:")
+		for _, name := range found.Lost {
+			fmt.Fprintf(out, "- %s\n", name)
+		}
+		fmt.Fprintf(out, "Remove them with 'adfinis-rclone-mgr gdrive-config%s'\n", profileFlag(activeProfile))
+	}
+}
+
+// zenityCanceled reports whether the user closed or canceled a zenity dialog.
+func zenityCanceled(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == 1
+}
+
+// askDrivesToAdd asks which of the new drives to add, a single drive gets a simple question.
+func askDrivesToAdd(drives []models.Drive) ([]models.Drive, error) {
+	if len(drives) == 1 {
+		cmd := exec.Command(
+			"zenity", "--question",
+			"--title", "New Shared Drive",
+			"--text", fmt.Sprintf("You were added to the shared drive %q.", drives[0].Name),
+			"--ok-label", "Add and mount",
+			"--cancel-label", "Not now",
+		)
+		if err := cmd.Run(); err != nil {
+			if zenityCanceled(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to ask about new drives: %w", err)
+		}
+		return drives, nil
+	}
+
+	args := []string{
+		"--list", "--checklist",
+		"--title", "New Shared Drives",
+		"--text", "You were added to these shared drives.",
+		"--ok-label", "Add and mount",
+		"--cancel-label", "Not now",
+		"--column", "", "--column", "ID", "--column", "Drive",
+		"--hide-column", "2", "--print-column", "2", "--separator", "\n",
+	}
+	for _, d := range drives {
+		args = append(args, "TRUE", d.ID, d.Name)
+	}
+	output, err := exec.Command("zenity", args...).Output()
+	if err != nil {
+		if zenityCanceled(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to ask about new drives: %w", err)
+	}
+	ids := strings.Fields(string(output))
+	return slices.DeleteFunc(slices.Clone(drives), func(d models.Drive) bool { return !slices.Contains(ids, d.ID) }), nil
+}
+
+// addDrives adds and mounts the drives the user picked in a notification.
+// drives are all drives, so the names of the new ones can be checked against them.
+func addDrives(ctx context.Context, drives, add []models.Drive, clientID, clientSecret string, token *oauth2.Token) error {
+	add = slices.Clone(add)
+	for i := range add {
+		add[i].Enabled = true
+		// like new drives in gdrive-config
+		add[i].AutoMount = true
+	}
+	if err := validateMountNames(add, reservedNames(drives, takenNames(), nil)); err != nil {
+		return fmt.Errorf("%w\nPick a local name with 'adfinis-rclone-mgr gdrive-config'", err)
+	}
+	return applySelection(ctx, add, nil, clientID, clientSecret, token)
+}
+
+// errNoCredentials is returned for profiles gdrive-config never ran with.
+var errNoCredentials = errors.New("no client_id and client_secret found, run 'adfinis-rclone-mgr gdrive-config' once")
+
+func discover(cmd *cobra.Command, _ []string) {
+	profiles := knownProfiles()
+	if cmd.Flags().Changed("profile") {
+		useProfile(discoverCmdFlags.Profile)
+		profiles = []string{activeProfile}
+	}
+	failed := false
+	for _, profile := range profiles {
+		activeProfile = profile
+		if len(profiles) > 1 && !discoverCmdFlags.Notify {
+			fmt.Fprintf(cmd.OutOrStdout(), "Profile %s:\n", profileDisplayName(profile))
+		}
+		err := discoverProfile(cmd, profile)
+		// e.g. only named profiles are used, there is nothing to discover in the default one
+		if errors.Is(err, errNoCredentials) && len(profiles) > 1 {
+			continue
+		}
+		if err != nil {
+			log.Printf("Profile %s: %v", profileDisplayName(profile), err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// discoverProfile looks for new and lost drives of the profile, it has to be the active one for the keyring.
+func discoverProfile(cmd *cobra.Command, profile string) error {
+	ctx := cmd.Context()
+	clientID, clientSecret := savedCredentials()
+	if clientID == "" {
+		return errNoCredentials
+	}
+	oauthConfig := newOAuthConfig(clientID, clientSecret)
+	token, err := existingToken(ctx, oauthConfig)
+	if err != nil {
+		return err
+	}
+	available, err := checkAvailableDrives(ctx, oauthConfig, token, profile)
+	if err != nil {
+		return fmt.Errorf("failed to check available drives: %w", err)
+	}
+	managed := driveRemotes(clientID, profile)
+	drives := withRemotes(applyLocalNames(available, loadLocalNames()), driveRemoteIDs(), managed)
+
+	state, err := loadState()
+	if err != nil {
+		return err
+	}
+	seen := state.discovery(profile)
+	found := discoverChanges(drives, managed, seen)
+	if !discoverCmdFlags.Notify {
+		printDiscovery(cmd.OutOrStdout(), found)
+		return nil
+	}
+
+	err = updateState(func(s *managerState) error {
+		s.setDiscovery(profile, discoveryState{
+			KnownDrives: driveIDs(drives),
+			LostRemotes: orphanedRemotes(managed, drives),
+			LastRun:     time.Now(),
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// the drives there are at the first run were there before the timer was enabled
+	if seen.LastRun.IsZero() {
+		log.Printf("Remembered %d drives, the next run notifies about new ones", len(drives))
+		return nil
+	}
+
+	if len(found.Lost) > 0 {
+		message := fmt.Sprintf("You don't have access to these drives anymore:\n%s\n\nRemove them with 'adfinis-rclone-mgr gdrive-config%s'.", strings.Join(found.Lost, "\n"), profileFlag(profile))
+		if err := sendDesktopNotificationInfo("Lost Access to Drives", message); err != nil {
+			log.Println(err)
+		}
+	}
+	if len(found.New) == 0 {
+		return nil
+	}
+	add, err := askDrivesToAdd(found.New)
+	if err != nil {
+		return err
+	}
+	if len(add) == 0 {
+		return nil
+	}
+	if err := addDrives(ctx, drives, add, clientID, clientSecret, token); err != nil {
+		if err := sendDesktopNotificationError("Failed to Add Drives", err.Error()); err != nil {
+			log.Println(err)
+		}
+		return err
+	}
+	var paths []string
+	for _, d := range add {
+		paths = append(paths, getDriveDataPath(driveMountName(d)))
+	}
+	if err := sendDesktopNotificationInfo("Drives Added", "Mounted at:\n"+strings.Join(paths, "\n")); err != nil {
+		log.Println(err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverChanges(t *testing.T) {
+	drives := []models.Drive{
+		{Name: "My Drive", ID: "my_drive"},
+		{Name: "Team", ID: "0AAA", Remote: "Team"},
+		{Name: "Known", ID: "0BBB"},
+		{Name: "Brand New", ID: "0CCC"},
+	}
+	found := discoverChanges(drives, []string{"Team", "Gone", "Told"}, discoveryState{
+		KnownDrives: []string{"0BBB"},
+		LostRemotes: []string{"Told"},
+	})
+	// My Drive isn't a shared drive, it's just not mounted
+	assert.Equal(t, []models.Drive{drives[3]}, found.New)
+	assert.Equal(t, []string{"Gone"}, found.Lost)
+}
+
+func TestRememberDrives(t *testing.T) {
+	useTempDirs(t)
+
+	assert.NoError(t, rememberDrives([]models.Drive{{Name: "Team", ID: "0AAA"}, {Name: "Removed"}}))
+	assert.NoError(t, rememberDrives([]models.Drive{{Name: "Team", ID: "0AAA"}, {Name: "Other", ID: "0BBB"}}))
+	state, err := loadState()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0AAA", "0BBB"}, state.Discovery.KnownDrives)
+	// gdrive-config doesn't count as a run of discover
+	assert.True(t, state.Discovery.LastRun.IsZero())
+}
+
+func TestPrintDiscovery(t *testing.T) {
+	var out bytes.Buffer
+	printDiscovery(&out, discovery{})
+	assert.Equal(t, "Nothing new\n", out.String())
+
+	out.Reset()
+	printDiscovery(&out, discovery{New: []models.Drive{{Name: "Brand New", ID: "0CCC"}}, Lost: []string{"Gone"}})
+	assert.Contains(t, out.String(), "- Brand New (0CCC)\n")
+	assert.Contains(t, out.String(), "No access anymore:\n- Gone\n")
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	godbus "github.com/godbus/dbus/v5"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	// unitVersion needs to be bumped whenever the unit files in assets/ change
+	unitVersion = 5
+	// minRcloneVersion is the first version supporting the remote control API on a unix socket
+	minRcloneVersion = "1.63"
+
+	excludeListPath = "/usr/share/adfinis-rclone-mgr/file-exclude-list.txt"
+)
+
+// managedUnits are the unit files shipped in assets/
+var managedUnits = []string{
+	"rclone@.service",
+	"adfinis-rclone-mgr@.service",
+	daemonUnitName,
+	automountTargetName,
+	"adfinis-rclone-mgr-discover.service",
+	discoverTimerName,
+}
+
+type checkStatus string
+
+const (
+	checkPass checkStatus = "pass"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+)
+
+type checkResult struct {
+	Name    string      `json:"name"`
+	Status  checkStatus `json:"status"`
+	Message string      `json:"message"`
+	Hint    string      `json:"hint,omitempty"`
+}
+
+func doctor(cmd *cobra.Command, _ []string) {
+	ctx := cmd.Context()
+
+	var results []checkResult
+	results = append(results, checkRclone())
+	results = append(results, checkFuse()...)
+	results = append(results, checkUnits()...)
+	results = append(results, checkExcludeList())
+	results = append(results, checkKeyring())
+	rcloneConfig := checkRcloneConfig()
+	results = append(results, rcloneConfig)
+	if rcloneConfig.Status != checkFail {
+		results = append(results, checkTokens())
+		results = append(results, checkMountDirs(ctx)...)
+	}
+	results = append(results, checkNotifications())
+
+	if doctorCmdFlags.JSON {
+		jsonData, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			log.Fatalln("Failed to marshal JSON:", err)
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		renderCheckResults(results)
+	}
+
+	for _, r := range results {
+		if r.Status == checkFail {
+			os.Exit(1)
+		}
+	}
+}
+
+func renderCheckResults(results []checkResult) {
+	rows := make([][]string, len(results))
+	for i, r := range results {
+		var prefix string
+		switch r.Status {
+		case checkPass:
+			prefix = "✅"
+		case checkWarn:
+			prefix = "⚠️"
+		case checkFail:
+			prefix = "☠️"
+		}
+		rows[i] = []string{prefix, r.Name, r.Message, r.Hint}
+	}
+
+	re := lipgloss.NewRenderer(os.Stdout)
+
+	cellStyle := re.NewStyle().Padding(0, 1)
+	headerStyle := cellStyle.Bold(true).Align(lipgloss.Center)
+
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("2e4b98"))).
+		StyleFunc(func(row, col int) lipgloss.Style {
+			switch row {
+			case table.HeaderRow:
+				return headerStyle
+			default:
+				return cellStyle
+			}
+		}).
+		Headers("Ok?", "Check", "Result", "Fix").
+		Rows(rows...)
+
+	fmt.Println()
+	fmt.Println(t)
+	fmt.Println()
+}
+
+var rcloneVersionRegex = regexp.MustCompile(`rclone v(\d+)\.(\d+)`)
+
+// parseRcloneVersion extracts major and minor version from the output of 'rclone version'.
+func parseRcloneVersion(output string) (major, minor int, ok bool) {
+	m := rcloneVersionRegex.FindStringSubmatch(output)
+	if len(m) < 3 {
+		return 0, 0, false
+	}
+	major, _ = strconv.Atoi(m[1])
+	minor, _ = strconv.Atoi(m[2])
+	return major, minor, true
+}
+
+func versionAtLeast(major, minor int, want string) bool {
+	var wantMajor, wantMinor int
+	if _, err := fmt.Sscanf(want, "%d.%d", &wantMajor, &wantMinor); err != nil {
+		return false
+	}
+	return major > wantMajor || (major == wantMajor && minor >= wantMinor)
+}
+
+func checkRclone() checkResult {
+	r := checkResult{Name: "rclone"}
+	bin, err := exec.LookPath("rclone")
+	if err != nil {
+		r.Status = checkFail
+		r.Message = "rclone not found in PATH"
+		r.Hint = "install rclone with your package manager"
+		return r
+	}
+	out, err := exec.Command(bin, "version").Output()
+	if err != nil {
+		r.Status = checkFail
+		r.Message = fmt.Sprintf("failed to run %s version: %v", bin, err)
+		r.Hint = "reinstall rclone"
+		return r
+	}
+	major, minor, ok := parseRcloneVersion(string(out))
+	if !ok {
+		r.Status = checkWarn
+		r.Message = fmt.Sprintf("unknown rclone version at %s", bin)
+		return r
+	}
+	if !versionAtLeast(major, minor, minRcloneVersion) {
+		r.Status = checkFail
+		r.Message = fmt.Sprintf("rclone v%d.%d at %s is too old", major, minor, bin)
+		r.Hint = fmt.Sprintf("install rclone v%s or newer", minRcloneVersion)
+		return r
+	}
+	r.Status = checkPass
+	r.Message = fmt.Sprintf("rclone v%d.%d at %s", major, minor, bin)
+	return r
+}
+
+func checkFuse() []checkResult {
+	fusermount := checkResult{Name: "fusermount"}
+	if p, err := findFusermount(); err != nil {
+		fusermount.Status = checkFail
+		fusermount.Message = err.Error() + ", drives can't be unmounted"
+		fusermount.Hint = "install fuse3 (or fuse) with your package manager, rclone@.service unmounts with fusermount3 or fusermount"
+	} else {
+		fusermount.Status = checkPass
+		fusermount.Message = p + " found"
+	}
+
+	device := checkResult{Name: "fuse device"}
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		device.Status = checkFail
+		device.Message = "/dev/fuse not available"
+		device.Hint = "load the fuse kernel module: sudo modprobe fuse"
+	} else {
+		device.Status = checkPass
+		device.Message = "/dev/fuse available"
+	}
+
+	fuseConf := checkResult{Name: "fuse.conf"}
+	if _, err := os.ReadFile("/etc/fuse.conf"); err != nil {
+		fuseConf.Status = checkWarn
+		fuseConf.Message = fmt.Sprintf("/etc/fuse.conf not readable: %v", err)
+		fuseConf.Hint = "install fuse3 with your package manager"
+	} else {
+		fuseConf.Status = checkPass
+		fuseConf.Message = "/etc/fuse.conf readable"
+	}
+	return []checkResult{fusermount, device, fuseConf}
+}
+
+// userUnitPaths are the directories systemd loads user units from, in order of precedence.
+func userUnitPaths() []string {
+	return []string{
+		path.Join(xdg.ConfigHome, "systemd", "user"),
+		"/etc/systemd/user",
+		"/usr/local/lib/systemd/user",
+		"/usr/lib/systemd/user",
+	}
+}
+
+// findUnitFile returns the path of the unit file systemd will use.
+func findUnitFile(name string, searchPaths []string) (string, bool) {
+	for _, dir := range searchPaths {
+		p := path.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+var unitVersionRegex = regexp.MustCompile(`(?m)^X-AdfinisRcloneMgrUnitVersion=(\d+)\s*$`)
+
+// unitFileVersion returns the version a unit file was shipped with, 0 if it has none.
+func unitFileVersion(content string) int {
+	m := unitVersionRegex.FindStringSubmatch(content)
+	if len(m) < 2 {
+		return 0
+	}
+	v, _ := strconv.Atoi(m[1])
+	return v
+}
+
+// unitExecBinary returns the binary of the first ExecStart= of a unit file.
+func unitExecBinary(content string) string {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "ExecStart=") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "ExecStart="))
+		if len(fields) == 0 {
+			return ""
+		}
+		return strings.TrimLeft(fields[0], "-@:+!")
+	}
+	return ""
+}
+
+func checkUnitFile(name string, searchPaths []string) checkResult {
+	r := checkResult{Name: name}
+	unitPath, ok := findUnitFile(name, searchPaths)
+	if !ok {
+		r.Status = checkFail
+		r.Message = "unit not installed"
+		r.Hint = "run adfinis-rclone-mgr install or reinstall the package"
+		return r
+	}
+	content, err := os.ReadFile(unitPath)
+	if err != nil {
+		r.Status = checkFail
+		r.Message = fmt.Sprintf("failed to read %s: %v", unitPath, err)
+		return r
+	}
+	if v := unitFileVersion(string(content)); v != unitVersion {
+		r.Status = checkWarn
+		r.Message = fmt.Sprintf("%s has version %d, expected %d", unitPath, v, unitVersion)
+		r.Hint = "update the adfinis-rclone-mgr package or run adfinis-rclone-mgr install"
+		return r
+	}
+	if unitPath == path.Join(getUserUnitDir(), name) && lo.Contains(outdatedUserUnits(), unitPath) {
+		r.Status = checkWarn
+		r.Message = fmt.Sprintf("%s doesn't match this version of adfinis-rclone-mgr", unitPath)
+		r.Hint = "run adfinis-rclone-mgr install"
+		return r
+	}
+	if bin := unitExecBinary(string(content)); bin != "" {
+		if _, err := os.Stat(bin); err != nil {
+			r.Status = checkFail
+			r.Message = fmt.Sprintf("%s runs %s, which doesn't exist", unitPath, bin)
+			r.Hint = "install the binary to the expected location"
+			return r
+		}
+	}
+	r.Status = checkPass
+	r.Message = unitPath
+	return r
+}
+
+func checkUnits() []checkResult {
+	results := make([]checkResult, len(managedUnits))
+	for i, name := range managedUnits {
+		results[i] = checkUnitFile(name, userUnitPaths())
+	}
+	return results
+}
+
+var excludeFromRegex = regexp.MustCompile(`--exclude-from\s+"?([^"\s]+)"?`)
+
+// unitExcludeList returns the exclude list the installed rclone@.service uses.
+func unitExcludeList() string {
+	unitPath, ok := findUnitFile("rclone@.service", userUnitPaths())
+	if !ok {
+		return excludeListPath
+	}
+	content, err := os.ReadFile(unitPath)
+	if err != nil {
+		return excludeListPath
+	}
+	m := excludeFromRegex.FindStringSubmatch(string(content))
+	if len(m) < 2 {
+		return excludeListPath
+	}
+	return m[1]
+}
+
+func checkExcludeList() checkResult {
+	r := checkResult{Name: "exclude list"}
+	p := unitExcludeList()
+	if _, err := os.Stat(p); err != nil {
+		r.Status = checkFail
+		r.Message = fmt.Sprintf("%s not found", p)
+		r.Hint = "run adfinis-rclone-mgr install or reinstall the package"
+		return r
+	}
+	r.Status = checkPass
+	r.Message = p
+	return r
+}
+
+func checkKeyring() checkResult {
+	r := checkResult{Name: "keyring"}
+	_, err := keyring.Get(keyringService, "client_id")
+	switch {
+	case err == nil:
+		r.Status = checkPass
+		r.Message = "Secret Service reachable, credentials stored"
+	case errors.Is(err, keyring.ErrNotFound):
+		r.Status = checkPass
+		r.Message = "Secret Service reachable, no credentials stored yet"
+	default:
+		r.Status = checkWarn
+		r.Message = fmt.Sprintf("Secret Service not reachable: %v", err)
+		r.Hint = "install and unlock a keyring like gnome-keyring, otherwise credentials have to be entered every time"
+	}
+	return r
+}
+
+func checkRcloneConfig() checkResult {
+	r := checkResult{Name: "rclone.conf"}
+	configPath := config.GetConfigPath()
+	err := config.Data().Load()
+	switch {
+	case err == nil:
+		r.Status = checkPass
+		r.Message = configPath
+	case errors.Is(err, config.ErrorConfigFileNotFound):
+		r.Status = checkWarn
+		r.Message = fmt.Sprintf("%s doesn't exist yet", configPath)
+		r.Hint = "run adfinis-rclone-mgr gdrive-config"
+	default:
+		r.Status = checkFail
+		r.Message = fmt.Sprintf("failed to load %s: %v", configPath, err)
+		r.Hint = "fix or remove the config file and rerun adfinis-rclone-mgr gdrive-config"
+	}
+	return r
+}
+
+// checkTokens makes sure all remotes of the account share one token, it doesn't ask Google whether it still works.
+func checkTokens() checkResult {
+	r := checkResult{Name: "tokens"}
+	clientID, _ := savedCredentials()
+	groups := groupTokens(remoteTokens(clientID, activeProfile))
+	switch {
+	case len(groups) == 0:
+		r.Status = checkPass
+		r.Message = "no remotes yet"
+	case slices.ContainsFunc(groups, func(g accountToken) bool { return g.Token == nil }):
+		r.Status = checkWarn
+		r.Message = "some remotes have no valid token"
+		r.Hint = "run adfinis-rclone-mgr reauth"
+	case len(groups) > 1:
+		r.Status = checkWarn
+		r.Message = fmt.Sprintf("the remotes use %d different tokens", len(groups))
+		r.Hint = "run adfinis-rclone-mgr reauth, 'reauth --check' shows which ones still work"
+	default:
+		r.Status = checkPass
+		r.Message = fmt.Sprintf("%d remotes share one token", len(groups[0].Remotes))
+	}
+	return r
+}
+
+// checkMountDir makes sure the mountpoint exists and rclone will be able to mount over it.
+func checkMountDir(name, mountPath string, mounted bool) checkResult {
+	r := checkResult{Name: fmt.Sprintf("mountpoint %s", name)}
+	entries, err := os.ReadDir(mountPath)
+	switch {
+	case os.IsNotExist(err):
+		r.Status = checkWarn
+		r.Message = fmt.Sprintf("%s doesn't exist", mountPath)
+		r.Hint = fmt.Sprintf("run adfinis-rclone-mgr mount %s", name)
+	case err != nil:
+		r.Status = checkFail
+		r.Message = fmt.Sprintf("failed to read %s: %v", mountPath, err)
+		r.Hint = fmt.Sprintf("adfinis-rclone-mgr umount --force %s", name)
+	case !mounted && len(entries) > 0:
+		r.Status = checkFail
+		r.Message = fmt.Sprintf("%s is not empty while unmounted", mountPath)
+		r.Hint = "move the files somewhere else, rclone refuses to mount over them"
+	default:
+		r.Status = checkPass
+		r.Message = mountPath
+	}
+	return r
+}
+
+func checkMountDirs(ctx context.Context) []checkResult {
+	remotes := getRemotes()
+	mounted := map[string]bool{}
+	sm, err := newServiceManager(ctx)
+	if err != nil {
+		return []checkResult{{
+			Name:    "systemd",
+			Status:  checkFail,
+			Message: fmt.Sprintf("failed to connect to the systemd user instance: %v", err),
+			Hint:    "make sure you are running in a session with a systemd user instance",
+		}}
+	}
+	defer sm.Close()
+	statuses, err := statusServices(ctx, sm, remotes)
+	if err != nil {
+		return []checkResult{{
+			Name:    "systemd",
+			Status:  checkFail,
+			Message: fmt.Sprintf("failed to get service status: %v", err),
+		}}
+	}
+	for _, status := range statuses {
+		mounted[unitNameToDriveName(status.Name)] = status.ActiveState == "active"
+	}
+
+	results := make([]checkResult, len(remotes))
+	for i, name := range remotes {
+		results[i] = checkMountDir(name, getDriveDataPath(name), mounted[name])
+	}
+	return results
+}
+
+func checkNotifications() checkResult {
+	r := checkResult{Name: "notifications"}
+	if _, err := exec.LookPath("zenity"); err == nil {
+		r.Status = checkPass
+		r.Message = "zenity found"
+		return r
+	}
+
+	// without zenity we can't ask the user anything, but at least notifications could be shown
+	r.Status = checkWarn
+	r.Hint = "install zenity to get error dialogs"
+	conn, err := godbus.ConnectSessionBus()
+	if err != nil {
+		r.Message = "zenity not found and no session bus"
+		return r
+	}
+	defer conn.Close() // nolint:errcheck
+	var hasOwner bool
+	err = conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, "org.freedesktop.Notifications").Store(&hasOwner)
+	if err != nil || !hasOwner {
+		r.Message = "neither zenity nor a notification daemon found"
+		return r
+	}
+	r.Message = "zenity not found, but a notification daemon is running"
+	return r
+}
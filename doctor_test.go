@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRcloneVersion(t *testing.T) {
+	major, minor, ok := parseRcloneVersion("rclone v1.69.3\n- os/version: fedora 42\n")
+	assert.True(t, ok)
+	assert.Equal(t, 1, major)
+	assert.Equal(t, 69, minor)
+	assert.True(t, versionAtLeast(major, minor, minRcloneVersion))
+	assert.False(t, versionAtLeast(1, 62, minRcloneVersion))
+	assert.True(t, versionAtLeast(2, 0, minRcloneVersion))
+
+	_, _, ok = parseRcloneVersion("command not found")
+	assert.False(t, ok)
+}
+
+func TestUnitFileHelpers(t *testing.T) {
+	content, err := os.ReadFile("assets/rclone@.service")
+	assert.NoError(t, err)
+	assert.Equal(t, unitVersion, unitFileVersion(string(content)))
+	assert.Equal(t, "/usr/bin/rclone", unitExecBinary(string(content)))
+	// the mountpoint is one argument, whatever the env file sets
+	assert.NotRegexp(t, `[^"]\$\{MOUNT_DIR\}`, string(content))
+
+	assert.Equal(t, 0, unitFileVersion("[Unit]\nDescription=old\n"))
+	assert.Equal(t, "/bin/true", unitExecBinary("[Service]\nExecStart=-/bin/true --flag\n"))
+}
+
+func TestCheckUnitFile(t *testing.T) {
+	user := t.TempDir()
+	system := t.TempDir()
+
+	r := checkUnitFile("test.service", []string{user, system})
+	assert.Equal(t, checkFail, r.Status)
+
+	// outdated unit in the user dir shadows the system unit
+	assert.NoError(t, os.WriteFile(filepath.Join(system, "test.service"), []byte(fmt.Sprintf("[Unit]\nX-AdfinisRcloneMgrUnitVersion=%d\n[Service]\nExecStart=/bin/sh\n", unitVersion)), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(user, "test.service"), []byte("[Unit]\n[Service]\nExecStart=/bin/sh\n"), 0o644))
+	r = checkUnitFile("test.service", []string{user, system})
+	assert.Equal(t, checkWarn, r.Status)
+
+	assert.NoError(t, os.Remove(filepath.Join(user, "test.service")))
+	r = checkUnitFile("test.service", []string{user, system})
+	assert.Equal(t, checkPass, r.Status)
+}
+
+func TestCheckMountDir(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, checkPass, checkMountDir("test", dir, false).Status)
+	assert.Equal(t, checkWarn, checkMountDir("test", filepath.Join(dir, "missing"), false).Status)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0o644))
+	assert.Equal(t, checkFail, checkMountDir("test", dir, false).Status)
+	assert.Equal(t, checkPass, checkMountDir("test", dir, true).Status)
+}
+
+func TestFindFusermount(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	_, err := findFusermount()
+	assert.ErrorContains(t, err, "neither fusermount3 nor fusermount found")
+
+	// fuse 2
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "fusermount"), []byte("#!/bin/sh\n"), 0o755))
+	p, err := findFusermount()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "fusermount"), p)
+
+	// fusermount3 is preferred
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "fusermount3"), []byte("#!/bin/sh\n"), 0o755))
+	p, err = findFusermount()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "fusermount3"), p)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+const folderMimeType = "application/vnd.google-apps.folder"
+
+// driveIDPattern matches the IDs of drives and folders, they are put into queries of the Drive API.
+var driveIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func newDriveService(ctx context.Context, oauthConfig *oauth2.Config, token *oauth2.Token) (*drive.Service, error) {
+	return drive.NewService(
+		ctx,
+		option.WithScopes(drive.DriveMetadataReadonlyScope),
+		option.WithTokenSource(oauthConfig.TokenSource(ctx, token)),
+	)
+}
+
+// parseFolderID returns the ID of a folder from its URL in Google Drive, an ID is returned as is.
+func parseFolderID(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if driveIDPattern.MatchString(input) {
+		return input, nil
+	}
+	u, err := url.Parse(input)
+	if err != nil || u.Host != "drive.google.com" {
+		return "", fmt.Errorf("%q is neither a Google Drive folder URL nor a folder ID", input)
+	}
+	// https://drive.google.com/open?id=<id>
+	id := u.Query().Get("id")
+	// https://drive.google.com/drive/folders/<id> and https://drive.google.com/drive/u/0/folders/<id>
+	if parts := strings.Split(strings.Trim(u.Path, "/"), "/"); len(parts) >= 2 && parts[len(parts)-2] == "folders" {
+		id = parts[len(parts)-1]
+	}
+	if !driveIDPattern.MatchString(id) {
+		return "", fmt.Errorf("%q isn't a link to a Google Drive folder", input)
+	}
+	return id, nil
+}
+
+// lookupFolder returns a folder as drive to mount on its own.
+func lookupFolder(ctx context.Context, srv *drive.Service, id string) (models.Drive, error) {
+	f, err := srv.Files.Get(id).Fields("id, name, mimeType, driveId").SupportsAllDrives(true).Context(ctx).Do()
+	if err != nil {
+		return models.Drive{}, fmt.Errorf("failed to get folder %s: %w", id, err)
+	}
+	if f.MimeType != folderMimeType {
+		return models.Drive{}, fmt.Errorf("%q isn't a folder", f.Name)
+	}
+	return models.Drive{Name: f.Name, ID: f.Id, Folder: true, TeamDrive: f.DriveId}, nil
+}
+
+// configuredFolders looks up the folders mounted with the client in the profile.
+// Folders the user has no access to anymore are left out, so their remotes show up as orphaned.
+func configuredFolders(ctx context.Context, srv *drive.Service, clientID, profile string) ([]models.Drive, error) {
+	var folders []models.Drive
+	for _, id := range folderRemoteIDs(clientID, profile) {
+		folder, err := lookupFolder(ctx, srv, id)
+		if err != nil {
+			var apiErr *googleapi.Error
+			if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+				continue
+			}
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+	return folders, nil
+}
+
+// folderEntry is a folder listed in the folder browser of the web UI.
+type folderEntry struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// MountName is the default name of the remote, the page can't sanitize names itself
+	MountName string `json:"mount_name"`
+}
+
+// listFolders returns the folders in parent, or at the top of the drive if parent is empty.
+func listFolders(ctx context.Context, srv *drive.Service, driveID, parent string) ([]folderEntry, error) {
+	if !driveIDPattern.MatchString(driveID) || (parent != "" && !driveIDPattern.MatchString(parent)) {
+		return nil, errors.New("invalid drive or folder ID")
+	}
+	query := fmt.Sprintf("mimeType = '%s' and trashed = false", folderMimeType)
+	switch {
+	case parent != "":
+		query += fmt.Sprintf(" and '%s' in parents", parent)
+	case driveID == "my_drive":
+		query += " and 'root' in parents"
+	case driveID == "shared_with_me":
+		query += " and sharedWithMe"
+	default:
+		query += fmt.Sprintf(" and '%s' in parents", driveID)
+	}
+	req := srv.Files.List().
+		Q(query).
+		Fields("nextPageToken, files(id, name)").
+		OrderBy("name").
+		PageSize(100).
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true).
+		Context(ctx)
+	switch driveID {
+	case "my_drive":
+		req = req.Corpora("user")
+	case "shared_with_me":
+		// folders shared with the user might be in shared drives as well
+		req = req.Corpora("allDrives")
+	default:
+		req = req.Corpora("drive").DriveId(driveID)
+	}
+
+	folders := []folderEntry{}
+	pageToken := ""
+	for {
+		if pageToken != "" {
+			req = req.PageToken(pageToken)
+		}
+		resp, err := req.Do()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list folders: %w", err)
+		}
+		for _, f := range resp.Files {
+			folders = append(folders, folderEntry{ID: f.Id, Name: f.Name, MountName: sanitizeDriveName(f.Name)})
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		pageToken = resp.NextPageToken
+	}
+	return folders, nil
+}
+
+func addFolder(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	useProfile(addFolderCmdFlags.Profile)
+	id, err := parseFolderID(args[0])
+	if err != nil {
+		log.Fatalln(err)
+	}
+	clientID, clientSecret := savedCredentials()
+	if clientID == "" {
+		log.Fatalln("No client_id and client_secret found, run 'adfinis-rclone-mgr gdrive-config' once")
+	}
+	oauthConfig := newOAuthConfig(clientID, clientSecret)
+	token, err := existingToken(ctx, oauthConfig)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	srv, err := newDriveService(ctx, oauthConfig, token)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	folder, err := lookupFolder(ctx, srv, id)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	folder.Profile = activeProfile
+	if remote := withRemotes([]models.Drive{folder}, driveRemoteIDs(), driveRemotes(clientID, activeProfile))[0].Remote; remote != "" {
+		log.Fatalf("%q is mounted as %s already", folder.Name, remote)
+	}
+
+	folder.LocalName = addFolderCmdFlags.Name
+	folder.Enabled = true
+	// like new drives in gdrive-config
+	folder.AutoMount = true
+	if err := validateMountNames([]models.Drive{folder}, takenNames()); err != nil {
+		log.Fatalf("%v\nPick another name with --name", err)
+	}
+	if err := applySelection(ctx, []models.Drive{folder}, nil, clientID, clientSecret, token); err != nil {
+		log.Fatalln("Failed to add folder:", err)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Mounted %q at %s\n", folder.Name, getDriveDataPath(driveMountName(folder)))
+}
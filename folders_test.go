@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/zalando/go-keyring"
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestParseFolderID(t *testing.T) {
+	for input, want := range map[string]string{
+		"1AbC-d_E":    "1AbC-d_E",
+		" 1AbC-d_E\n": "1AbC-d_E",
+		"https://drive.google.com/drive/folders/1AbC-d_E":                 "1AbC-d_E",
+		"https://drive.google.com/drive/folders/1AbC-d_E?usp=sharing":     "1AbC-d_E",
+		"https://drive.google.com/drive/u/1/folders/1AbC-d_E":             "1AbC-d_E",
+		"https://drive.google.com/open?id=1AbC-d_E":                       "1AbC-d_E",
+		"https://drive.google.com/drive/folders/1AbC-d_E/?resourcekey=0-": "1AbC-d_E",
+	} {
+		id, err := parseFolderID(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, id, input)
+	}
+	for _, input := range []string{
+		"",
+		"https://example.com/drive/folders/1AbC",
+		"https://drive.google.com/drive/my-drive",
+		"1AbC' or trashed = true",
+	} {
+		_, err := parseFolderID(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestFolderRemoteIDs(t *testing.T) {
+	useTempRcloneConfig(t, testRcloneConfig+`
+[Reports]
+type = drive
+team_drive = 0AAA
+root_folder_id = 1FFF
+client_id = ours
+
+[Reports_Copy]
+type = drive
+root_folder_id = 1FFF
+client_id = ours
+
+[Private]
+type = drive
+root_folder_id = 1GGG
+client_id = theirs
+`)
+
+	assert.Equal(t, []string{"1FFF"}, folderRemoteIDs("ours", ""))
+	// the folder is what the remote mounts, not the shared drive it's in
+	assert.Equal(t, "1FFF", remoteDriveID("Reports"))
+	assert.Equal(t, "0AAA", remoteDriveID("Old_Name"))
+}
+
+// newTestDriveService returns a Drive API client talking to the handler.
+func newTestDriveService(t *testing.T, handler http.HandlerFunc) *drive.Service {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	service, err := drive.NewService(context.Background(), option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return service
+}
+
+func TestLookupFolder(t *testing.T) {
+	service := newTestDriveService(t, func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/files/") {
+		case "1FFF":
+			_ = json.NewEncoder(w).Encode(drive.File{Id: "1FFF", Name: "Reports", MimeType: folderMimeType, DriveId: "0AAA"})
+		case "1DOC":
+			_ = json.NewEncoder(w).Encode(drive.File{Id: "1DOC", Name: "Report.pdf", MimeType: "application/pdf"})
+		default:
+			http.Error(w, `{"error": {"code": 404, "message": "File not found"}}`, http.StatusNotFound)
+		}
+	})
+	ctx := context.Background()
+
+	folder, err := lookupFolder(ctx, service, "1FFF")
+	assert.NoError(t, err)
+	assert.Equal(t, models.Drive{Name: "Reports", ID: "1FFF", Folder: true, TeamDrive: "0AAA"}, folder)
+	_, err = lookupFolder(ctx, service, "1DOC")
+	assert.ErrorContains(t, err, "isn't a folder")
+
+	useTempRcloneConfig(t, `
+[Reports]
+type = drive
+root_folder_id = 1FFF
+client_id = ours
+
+[Gone]
+type = drive
+root_folder_id = 1GONE
+client_id = ours
+`)
+	// there is no access to 1GONE anymore, its remote is orphaned
+	folders, err := configuredFolders(ctx, service, "ours", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Drive{folder}, folders)
+}
+
+func TestListFolders(t *testing.T) {
+	var queries []string
+	service := newTestDriveService(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("q")+" corpora="+r.URL.Query().Get("corpora"))
+		list := drive.FileList{Files: []*drive.File{{Id: "1FFF", Name: "Team Reports"}}}
+		if r.URL.Query().Get("pageToken") == "" {
+			list.NextPageToken = "next"
+		}
+		_ = json.NewEncoder(w).Encode(list)
+	})
+	ctx := context.Background()
+
+	folders, err := listFolders(ctx, service, "0AAA", "")
+	assert.NoError(t, err)
+	// both pages
+	assert.Equal(t, []folderEntry{
+		{ID: "1FFF", Name: "Team Reports", MountName: "Team_Reports"},
+		{ID: "1FFF", Name: "Team Reports", MountName: "Team_Reports"},
+	}, folders)
+	assert.Contains(t, queries[0], "'0AAA' in parents corpora=drive")
+
+	queries = nil
+	_, err = listFolders(ctx, service, "my_drive", "")
+	assert.NoError(t, err)
+	assert.Contains(t, queries[0], "'root' in parents corpora=user")
+
+	queries = nil
+	_, err = listFolders(ctx, service, "shared_with_me", "1FFF")
+	assert.NoError(t, err)
+	assert.Contains(t, queries[0], "'1FFF' in parents corpora=allDrives")
+
+	_, err = listFolders(ctx, service, "0AAA", "x' in parents or '1")
+	assert.Error(t, err)
+}
+
+func TestHttpHandlerFoldersNotLoggedIn(t *testing.T) {
+	keyring.MockInit()
+	h := newHttpHandler(context.Background(), func() {})
+
+	req := httptest.NewRequest("GET", testBaseURL+"/folders?drive=my_drive", nil)
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+
+	cookie, _ := startSession(t, h)
+	req = httptest.NewRequest("GET", testBaseURL+"/folders?drive=my_drive", nil)
+	req.AddCookie(cookie)
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+}
@@ -2,48 +2,53 @@ package main
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os/exec"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/adfinis/adfinis-rclone-mgr/models"
 	"github.com/adfinis/adfinis-rclone-mgr/templates"
-	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	drive "google.golang.org/api/drive/v3"
-	"google.golang.org/api/option"
 )
 
 const (
 	listenPort = 53682
 )
 
-var (
-	state = uuid.NewString()
-)
+// loopbackAddrs are the addresses the config server listens on, localhost might resolve to either of them.
+var loopbackAddrs = []string{"127.0.0.1", "::1"}
 
 func gdriveConfig(cmd *cobra.Command, _ []string) {
+	useProfile(gdriveConfigCmdFlags.Profile)
+	if gdriveConfigCmdFlags.From != "" {
+		gdriveConfigFromFile(cmd)
+		return
+	}
+	if gdriveConfigCmdFlags.NoBrowser {
+		gdriveConfigNoBrowser(cmd)
+		return
+	}
 	ctx, cancel := context.WithCancel(cmd.Context())
 
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", listenPort),
-		Handler: newHttpHandler(ctx, cancel),
+		Handler:           newHttpHandler(ctx, cancel),
+		ReadHeaderTimeout: 10 * time.Second,
 	}
-	go func() {
-		log.Printf("Visit http://localhost:%d to start login", listenPort)
-		openBrowser(fmt.Sprintf("http://localhost:%d/", listenPort))
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-			log.Fatalf("HTTP server error: %v", err)
-		}
-	}()
+	if err := serveLoopback(srv); err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("Visit http://localhost:%d to start login", listenPort)
+	openBrowser(fmt.Sprintf("http://localhost:%d/", listenPort))
 
 	select {
 	case <-ctx.Done():
@@ -60,6 +65,41 @@ func gdriveConfig(cmd *cobra.Command, _ []string) {
 	log.Println("Server shutdown gracefully")
 }
 
+// serveLoopback serves on the redirect port of all loopback addresses, the redirect has to reach it.
+func serveLoopback(srv *http.Server) error {
+	var listeners []net.Listener
+	for _, addr := range loopbackAddrs {
+		l, err := net.Listen("tcp", net.JoinHostPort(addr, fmt.Sprint(listenPort)))
+		if err != nil {
+			// e.g. IPv6 is disabled
+			log.Printf("Failed to listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, l)
+	}
+	if len(listeners) == 0 {
+		return fmt.Errorf("failed to listen on port %d", listenPort)
+	}
+	for _, l := range listeners {
+		go func() {
+			if err := srv.Serve(l); err != http.ErrServerClosed {
+				log.Fatalf("HTTP server error: %v", err)
+			}
+		}()
+	}
+	return nil
+}
+
+func newOAuthConfig(clientID, clientSecret string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  fmt.Sprintf("http://localhost:%d/auth", listenPort),
+		Scopes:       []string{drive.DriveScope},
+		Endpoint:     google.Endpoint,
+	}
+}
+
 func openBrowser(url string) {
 	var err error
 	switch runtime.GOOS {
@@ -76,29 +116,74 @@ func openBrowser(url string) {
 	}
 }
 
-func newHttpHandler(ctx context.Context, cancel context.CancelFunc) *http.ServeMux {
+// loopbackOnly rejects requests for other hosts, so a website can't reach the server through DNS rebinding.
+func loopbackOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			http.Error(w, "Invalid host", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// contentSecurityPolicy only allows the embedded assets, the login form is redirected to Google.
+const contentSecurityPolicy = "default-src 'none'; style-src 'self'; script-src 'self'; img-src 'self' data:; connect-src 'self'; " +
+	"form-action 'self' https://accounts.google.com; base-uri 'none'; frame-ancestors 'none'"
+
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// the URL of /auth contains the authorization code
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func renderError(ctx context.Context, w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	if err := templates.ComponentError(err.Error()).Render(ctx, w); err != nil {
+		log.Printf("Failed to render template: %v", err)
+	}
+}
+
+func newHttpHandler(ctx context.Context, cancel context.CancelFunc) http.Handler {
 	router := http.NewServeMux()
+	sessions := newSessionStore()
+
+	router.Handle("GET /static/", http.FileServerFS(templates.Static))
 
-	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
 		// try to read the oidc credentials from the local keyring
 		clientID, clientSecret, err := getCredentials()
 		if err != nil {
 			log.Printf("Failed to get credentials from keyring: %v", err)
 		}
-		if err := templates.ComponentInputForm(clientID, clientSecret).Render(ctx, w); err != nil {
+		session := sessions.create(w)
+		if err := templates.ComponentInputForm(clientID, clientSecret, session.csrf).Render(ctx, w); err != nil {
 			log.Printf("Failed to render template: %v", err)
 			http.Error(w, "Failed to render template", http.StatusInternalServerError)
 			return
 		}
 	})
 
-	router.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseForm(); err != nil {
 			http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
 			return
 		}
-		clientID := r.FormValue("client_id")
-		clientSecret := r.FormValue("client_secret")
+		session, ok := sessions.get(r)
+		if !ok || !session.validCSRF(r.PostFormValue("csrf")) {
+			http.Error(w, "Invalid or expired session, reload the page", http.StatusForbidden)
+			return
+		}
+		clientID := r.PostFormValue("client_id")
+		clientSecret := r.PostFormValue("client_secret")
 		if clientID == "" || clientSecret == "" {
 			http.Error(w, "Missing client_id or client_secret", http.StatusBadRequest)
 			return
@@ -109,184 +194,185 @@ func newHttpHandler(ctx context.Context, cancel context.CancelFunc) *http.ServeM
 			log.Printf("Failed to set credentials in keyring: %v", err)
 		}
 
-		oauthConfig := &oauth2.Config{
-			ClientID:     clientID,
-			ClientSecret: clientSecret,
-			RedirectURL:  fmt.Sprintf("http://localhost:%d/auth", listenPort),
-			Scopes:       []string{drive.DriveScope},
-			Endpoint:     google.Endpoint,
-		}
-
-		sessionRaw := fmt.Sprintf("%s|%s", clientID, clientSecret)
-		sessionEncoded := base64.StdEncoding.EncodeToString([]byte(sessionRaw))
-		http.SetCookie(w, &http.Cookie{
-			Name:    "oidc",
-			Value:   sessionEncoded,
-			Expires: time.Now().Add(time.Hour)},
-		)
-
-		url := oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
+		sessions.startLogin(session, clientID, clientSecret)
+		oauthConfig := newOAuthConfig(clientID, clientSecret)
+		url := oauthConfig.AuthCodeURL(session.state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(session.verifier))
 		http.Redirect(w, r, url, http.StatusFound)
 	})
 
-	router.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Query().Get("state") != state {
+	router.HandleFunc("GET /auth", func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessions.byState(r.URL.Query().Get("state"))
+		if !ok {
 			http.Error(w, "Invalid state parameter", http.StatusBadRequest)
 			return
 		}
-
-		code := r.URL.Query().Get("code")
-		cookie, err := r.Cookie("oidc")
-		if err != nil {
-			http.Error(w, "missing oidc cookie", http.StatusBadRequest)
+		if e := r.URL.Query().Get("error"); e != "" {
+			renderError(ctx, w, http.StatusBadRequest, fmt.Errorf("login failed: %s", e))
 			return
 		}
 
-		cookieValue, err := base64.StdEncoding.DecodeString(cookie.Value)
+		oauthConfig := newOAuthConfig(session.clientID, session.clientSecret)
+		token, err := oauthConfig.Exchange(ctx, r.URL.Query().Get("code"), oauth2.VerifierOption(session.verifier))
 		if err != nil {
-			http.Error(w, "Failed to decode oidc cookie: "+err.Error(), http.StatusBadRequest)
-			return
-		}
-		parts := strings.SplitN(string(cookieValue), "|", 2)
-		if len(parts) != 2 {
-			http.Error(w, "Invalid oidc cookie", http.StatusBadRequest)
-			log.Println(parts)
-			return
-		}
-
-		clientID, clientSecret := parts[0], parts[1]
-
-		oauthConfig := &oauth2.Config{
-			ClientID:     clientID,
-			ClientSecret: clientSecret,
-			RedirectURL:  fmt.Sprintf("http://localhost:%d/auth", listenPort),
-			Scopes:       []string{drive.DriveScope},
-			Endpoint:     google.Endpoint,
-		}
-
-		token, err := oauthConfig.Exchange(ctx, code)
-		if err != nil {
-			http.Error(w, "Failed to exchange token: "+err.Error(), http.StatusInternalServerError)
+			renderError(ctx, w, http.StatusInternalServerError, fmt.Errorf("failed to exchange token: %w", err))
 			return
 		}
+		session.token = token
 
-		tokenString, err := json.Marshal(token)
+		mySharedDrives, err := checkAvailableDrives(ctx, oauthConfig, token, activeProfile)
 		if err != nil {
-			http.Error(w, "Failed to serialize token: "+err.Error(), http.StatusInternalServerError)
+			renderError(ctx, w, http.StatusInternalServerError, fmt.Errorf("failed to check available drives: %w", err))
 			return
 		}
-		tokenStringEncoded := base64.StdEncoding.EncodeToString(tokenString)
-		http.SetCookie(w, &http.Cookie{
-			Name:    "token",
-			Value:   tokenStringEncoded,
-			Expires: time.Now().Add(time.Hour),
-		})
-
-		w.WriteHeader(http.StatusOK)
-
-		mySharedDrives, err := checkAvailableDrives(ctx, oauthConfig, token)
-		if err != nil {
-			http.Error(w, "Failed to check available drives: "+err.Error(), http.StatusInternalServerError)
+		session.drives, session.orphans = currentSelection(ctx, mySharedDrives, session.clientID, activeProfile)
+		defaultNames := map[string]string{}
+		for _, d := range session.drives {
+			defaultNames[d.ID] = sanitizeDriveName(d.Name)
 		}
+		reserved := reservedNames(session.drives, takenNames(), nil)
 
-		if err := templates.ComponentDriveSelection(mySharedDrives).Render(ctx, w); err != nil {
+		if err := templates.ComponentDriveSelection(session.drives, defaultNames, activeProfile, profilePrefix(activeProfile), reserved, session.orphans, session.csrf).Render(ctx, w); err != nil {
 			log.Printf("Failed to render template: %v", err)
 			http.Error(w, "Failed to render template", http.StatusInternalServerError)
 			return
 		}
 	})
 
-	router.HandleFunc("/generate", func(w http.ResponseWriter, r *http.Request) {
-		defer cancel()
-
-		cookie, err := r.Cookie("token")
-		if err != nil {
-			http.Error(w, "missing token cookie", http.StatusBadRequest)
-			return
-		}
-		// decode the token
-		tokenValue, err := base64.StdEncoding.DecodeString(cookie.Value)
-		if err != nil {
-			http.Error(w, "Failed to decode token: "+err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		cookie, err = r.Cookie("oidc")
-		if err != nil {
-			http.Error(w, "missing oidc cookie", http.StatusBadRequest)
+	router.HandleFunc("POST /generate", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
 			return
 		}
-		// decode the oidc cookie
-		cookieValue, err := base64.StdEncoding.DecodeString(cookie.Value)
-		if err != nil {
-			http.Error(w, "Failed to decode oidc cookie: "+err.Error(), http.StatusBadRequest)
+		session, ok := sessions.get(r)
+		if !ok || !session.validCSRF(r.PostFormValue("csrf")) {
+			http.Error(w, "Invalid or expired session, reload the page", http.StatusForbidden)
 			return
 		}
-		parts := strings.SplitN(string(cookieValue), "|", 2)
-		clientID, clientSecret := parts[0], parts[1]
-
-		if err := r.ParseForm(); err != nil {
-			http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
+		if session.token == nil {
+			http.Error(w, "Not logged in", http.StatusBadRequest)
 			return
 		}
 
 		enabled := map[string]bool{}
-		for _, id := range r.Form["drive"] {
+		for _, id := range r.PostForm["drive"] {
 			enabled[id] = true
 		}
 		automount := map[string]bool{}
-		for _, id := range r.Form["automount"] {
+		for _, id := range r.PostForm["automount"] {
 			automount[id] = true
 		}
+		shown := map[string]models.Drive{}
+		for _, d := range session.drives {
+			shown[d.ID] = d
+		}
 		var result []models.Drive
-		for _, idName := range r.Form["drive_name"] {
-			idNameParts := strings.SplitN(idName, ":", 2)
-			id := idNameParts[0]
-			name := idNameParts[1]
+		for _, idName := range r.PostForm["drive_name"] {
+			id, name, ok := strings.Cut(idName, ":")
+			if !ok {
+				continue
+			}
 			result = append(result, models.Drive{
 				Name:      name,
 				ID:        id,
 				Enabled:   enabled[id],
 				AutoMount: automount[id],
+				LocalName: strings.TrimSpace(r.PostForm.Get("local_name:" + id)),
+				Remote:    shown[id].Remote,
+				Folder:    shown[id].Folder,
+				TeamDrive: shown[id].TeamDrive,
+				Profile:   activeProfile,
 			})
 		}
-
-		if err := handleRcloneConfig(ctx, result, clientID, clientSecret, string(tokenValue)); err != nil {
-			log.Printf("Failed to handle rclone config: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			if err := templates.ComponentError(err.Error()).Render(ctx, w); err != nil {
-				log.Printf("Failed to render template: %v", err)
-				http.Error(w, "Failed to render template", http.StatusInternalServerError)
+		// folders added in the folder browser, only the ID is taken from the page
+		for _, id := range r.PostForm["folder"] {
+			if !enabled[id] || slices.ContainsFunc(result, func(d models.Drive) bool { return d.ID == id }) {
+				continue
 			}
-			return
-		}
-
-		if err := handleSystemdServices(ctx, result); err != nil {
-			log.Printf("Failed to handle systemd services: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			if err := templates.ComponentError(err.Error()).Render(ctx, w); err != nil {
-				log.Printf("Failed to render template: %v", err)
-				http.Error(w, "Failed to render template", http.StatusInternalServerError)
+			folder, err := lookupSessionFolder(ctx, session, id)
+			if err != nil {
+				renderError(ctx, w, http.StatusBadRequest, err)
 				return
 			}
-		} else {
-			w.WriteHeader(http.StatusOK)
-			if err := templates.ComponentSuccess().Render(ctx, w); err != nil {
-				log.Printf("Failed to render template: %v", err)
-				http.Error(w, "Failed to render template", http.StatusInternalServerError)
-				return
+			folder.Enabled = true
+			folder.Profile = activeProfile
+			folder.AutoMount = automount[id]
+			folder.LocalName = strings.TrimSpace(r.PostForm.Get("local_name:" + id))
+			result = append(result, folder)
+		}
+		var removed []string
+		for _, name := range r.PostForm["remove"] {
+			// only remotes that were offered can be removed
+			if slices.Contains(session.orphans, name) {
+				removed = append(removed, name)
 			}
 		}
+		// the names are checked while typing already, this only happens if the page was tampered with
+		if err := validateMountNames(result, reservedNames(session.drives, takenNames(), removed)); err != nil {
+			renderError(ctx, w, http.StatusBadRequest, err)
+			return
+		}
+
+		// the server stops once the config is generated
+		defer cancel()
+		defer sessions.remove(session)
+
+		if err := applySelection(ctx, result, removed, session.clientID, session.clientSecret, session.token); err != nil {
+			log.Println(err)
+			renderError(ctx, w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if err := templates.ComponentSuccess().Render(ctx, w); err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
 	})
-	return router
+
+	router.HandleFunc("GET /folders", func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessions.get(r)
+		if !ok || session.token == nil {
+			http.Error(w, "Invalid or expired session, reload the page", http.StatusForbidden)
+			return
+		}
+		driveID := r.URL.Query().Get("drive")
+		if !slices.ContainsFunc(session.drives, func(d models.Drive) bool { return d.ID == driveID && !d.Folder }) {
+			http.Error(w, "Unknown drive", http.StatusBadRequest)
+			return
+		}
+		srv, err := newDriveService(ctx, newOAuthConfig(session.clientID, session.clientSecret), session.token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		folders, err := listFolders(ctx, srv, driveID, r.URL.Query().Get("parent"))
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(folders); err != nil {
+			log.Printf("Failed to write folders: %v", err)
+		}
+	})
+	return loopbackOnly(securityHeaders(router))
+}
+
+// lookupSessionFolder looks up a folder picked in the folder browser with the token of the session.
+func lookupSessionFolder(ctx context.Context, session *authSession, id string) (models.Drive, error) {
+	if !driveIDPattern.MatchString(id) {
+		return models.Drive{}, fmt.Errorf("invalid folder ID %q", id)
+	}
+	srv, err := newDriveService(ctx, newOAuthConfig(session.clientID, session.clientSecret), session.token)
+	if err != nil {
+		return models.Drive{}, err
+	}
+	return lookupFolder(ctx, srv, id)
 }
 
-func checkAvailableDrives(ctx context.Context, oauthConfig *oauth2.Config, token *oauth2.Token) ([]models.Drive, error) {
-	driveService, err := drive.NewService(
-		ctx,
-		option.WithScopes(drive.DriveMetadataReadonlyScope),
-		option.WithTokenSource(oauthConfig.TokenSource(ctx, token)),
-	)
+// checkAvailableDrives lists the drives of the user together with the folders mounted on their own.
+// The token belongs to the account of the profile, the drives are set up in it.
+func checkAvailableDrives(ctx context.Context, oauthConfig *oauth2.Config, token *oauth2.Token, profile string) ([]models.Drive, error) {
+	driveService, err := newDriveService(ctx, oauthConfig, token)
 	if err != nil {
 		return nil, err
 	}
@@ -301,9 +387,28 @@ func checkAvailableDrives(ctx context.Context, oauthConfig *oauth2.Config, token
 			ID:   "shared_with_me",
 		},
 	}
+	listed, err := listSharedDrives(ctx, driveService)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := configuredFolders(ctx, driveService, oauthConfig.ClientID, profile)
+	if err != nil {
+		return nil, err
+	}
+	drives := append(append(sharedDrives, listed...), folders...)
+	for i := range drives {
+		drives[i].Profile = profile
+	}
+	return drives, nil
+}
+
+// listSharedDrives lists the shared drives of the user, some organisations have hundreds of them.
+func listSharedDrives(ctx context.Context, driveService *drive.Service) ([]models.Drive, error) {
+	var sharedDrives []models.Drive
+	// 100 is the maximum page size, only the fields that are used are fetched
+	req := driveService.Drives.List().PageSize(100).Fields("nextPageToken, drives(id, name)").Context(ctx)
 	pageToken := ""
 	for {
-		req := driveService.Drives.List().PageSize(10)
 		if pageToken != "" {
 			req = req.PageToken(pageToken)
 		}
@@ -327,3 +432,113 @@ func checkAvailableDrives(ctx context.Context, oauthConfig *oauth2.Config, token
 	}
 	return sharedDrives, nil
 }
+
+// withCurrentState marks the drives that are set up already, so the selection starts from what is configured.
+func withCurrentState(drives []models.Drive, current map[string]driveStatus) []models.Drive {
+	marked := slices.Clone(drives)
+	for i := range marked {
+		var cur driveStatus
+		if marked[i].Remote != "" {
+			cur = current[marked[i].Remote]
+		}
+		marked[i].Enabled = cur.Remote
+		marked[i].AutoMount = cur.Remote && cur.AutoMount
+	}
+	return marked
+}
+
+// orphanedRemotes returns the remotes that don't belong to any of the drives, e.g. because the access was revoked.
+func orphanedRemotes(remotes []string, drives []models.Drive) []string {
+	var orphans []string
+	for _, name := range remotes {
+		if !slices.ContainsFunc(drives, func(d models.Drive) bool { return d.Remote == name }) {
+			orphans = append(orphans, name)
+		}
+	}
+	return orphans
+}
+
+// currentSelection returns the drives with their current state and the remotes of the client in the profile without a drive.
+// Without a service manager only the remotes are known.
+func currentSelection(ctx context.Context, drives []models.Drive, clientID, profile string) ([]models.Drive, []string) {
+	managed := driveRemotes(clientID, profile)
+	drives = withRemotes(applyLocalNames(drives, loadLocalNames()), driveRemoteIDs(), managed)
+	current := map[string]driveStatus{}
+	for _, d := range drives {
+		if d.Remote != "" {
+			current[d.Remote] = driveStatus{Remote: true}
+		}
+	}
+	sm, err := newServiceManager(ctx)
+	if err != nil {
+		log.Printf("Failed to get the state of the mounts: %v", err)
+	} else {
+		defer sm.Close()
+		if status, err := currentDriveStatus(ctx, sm, drives); err != nil {
+			log.Printf("Failed to get the state of the mounts: %v", err)
+		} else {
+			current = status
+		}
+	}
+	return withCurrentState(drives, current), orphanedRemotes(managed, drives)
+}
+
+// removalsFirst orders the drives to remove before the ones to add, a new drive might take over the name of a removed one.
+func removalsFirst(drives []models.Drive) []models.Drive {
+	sorted := slices.Clone(drives)
+	slices.SortStableFunc(sorted, func(a, b models.Drive) int {
+		switch {
+		case a.Enabled == b.Enabled:
+			return 0
+		case a.Enabled:
+			return 1
+		default:
+			return -1
+		}
+	})
+	return sorted
+}
+
+// applySelection sets up the drives picked in the web UI or the terminal, removed are orphaned remotes to delete.
+// Drives that got a new name are renamed first, so they keep their cache and settings.
+func applySelection(ctx context.Context, drives []models.Drive, removed []string, clientID, clientSecret string, token *oauth2.Token) error {
+	tokenString, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to serialize token: %w", err)
+	}
+	// drives of the profile would be mounted inside the remote named like it
+	if err := rememberProfile(activeProfile); err != nil {
+		return err
+	}
+	if err := saveLocalNames(drives); err != nil {
+		log.Printf("Failed to save local names: %v", err)
+	}
+	// 'discover' only notifies about drives that weren't shown here
+	if err := rememberDrives(drives); err != nil {
+		log.Printf("Failed to remember drives: %v", err)
+	}
+	drives, err = handleRenames(ctx, drives)
+	if err != nil {
+		return err
+	}
+	// drives that are neither picked nor configured have nothing to remove, their name might even belong to another drive
+	drives = slices.DeleteFunc(slices.Clone(drives), func(d models.Drive) bool { return !d.Enabled && d.Remote == "" })
+	for _, name := range removed {
+		drives = append(drives, models.Drive{Name: name, Remote: name, Profile: activeProfile})
+	}
+	drives = removalsFirst(drives)
+
+	if err := handleRcloneConfig(ctx, drives, clientID, clientSecret, string(tokenString)); err != nil {
+		return fmt.Errorf("failed to handle rclone config: %w", err)
+	}
+	// the remotes that weren't touched get the new token as well, all remotes of the account share one
+	setRemoteTokens(clientID, activeProfile, string(tokenString))
+	// 'gdrive-config --from' reuses the token
+	if err := setToken(string(tokenString)); err != nil {
+		log.Printf("Failed to save token in keyring: %v", err)
+	}
+	if err := handleSystemdServices(ctx, drives); err != nil {
+		return fmt.Errorf("failed to handle systemd services: %w", err)
+	}
+	return nil
+}
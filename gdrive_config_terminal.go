@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
+	"golang.org/x/term"
+)
+
+// terminalPrompt asks questions line by line, so the answers can also be piped in.
+type terminalPrompt struct {
+	in  *bufio.Reader
+	out io.Writer
+	// readPassword reads a line without echoing it, nil if the input isn't a terminal
+	readPassword func() ([]byte, error)
+}
+
+func newTerminalPrompt(in io.Reader, out io.Writer) *terminalPrompt {
+	p := &terminalPrompt{in: bufio.NewReader(in), out: out}
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		p.readPassword = func() ([]byte, error) {
+			return term.ReadPassword(int(f.Fd()))
+		}
+	}
+	return p
+}
+
+func (p *terminalPrompt) readLine() (string, error) {
+	line, err := p.in.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", fmt.Errorf("failed to read answer: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// ask prints the question and returns the answer, an empty answer keeps def.
+func (p *terminalPrompt) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	answer, err := p.readLine()
+	if err != nil {
+		return "", err
+	}
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// askSecret is like ask, but doesn't echo the answer or show the default.
+func (p *terminalPrompt) askSecret(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [keep saved]: ", question)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	var answer string
+	if p.readPassword != nil {
+		b, err := p.readPassword()
+		fmt.Fprintln(p.out)
+		if err != nil {
+			return "", fmt.Errorf("failed to read answer: %w", err)
+		}
+		answer = strings.TrimSpace(string(b))
+	} else {
+		var err error
+		if answer, err = p.readLine(); err != nil {
+			return "", err
+		}
+	}
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// parseAuthResponse returns the authorization code from the pasted redirect URL.
+// The code can also be pasted on its own, then there is no state to check.
+func parseAuthResponse(input, wantState string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", errors.New("no code given")
+	}
+	if !strings.Contains(input, "code=") && !strings.Contains(input, "error=") {
+		return input, nil
+	}
+
+	var query url.Values
+	u, err := url.Parse(input)
+	if err == nil && u.RawQuery != "" {
+		query = u.Query()
+	} else if query, err = url.ParseQuery(strings.TrimPrefix(input, "?")); err != nil {
+		return "", fmt.Errorf("failed to parse redirect URL: %w", err)
+	}
+	if e := query.Get("error"); e != "" {
+		return "", fmt.Errorf("authorization failed: %s", e)
+	}
+	if query.Get("state") != wantState {
+		return "", errors.New("invalid state parameter, use the URL printed above")
+	}
+	code := query.Get("code")
+	if code == "" {
+		return "", errors.New("missing code in redirect URL")
+	}
+	return code, nil
+}
+
+// parseSelection parses answers like "1,3-5", "all" or "none" into sorted indexes starting with 0.
+func parseSelection(input string, n int) ([]int, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	switch input {
+	case "all":
+		indexes := make([]int, n)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, nil
+	case "none", "-", "":
+		return nil, nil
+	}
+
+	var indexes []int
+	for _, field := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == ' ' }) {
+		from, to, isRange := strings.Cut(field, "-")
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", from)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(to); err != nil {
+				return nil, fmt.Errorf("invalid number %q", to)
+			}
+		}
+		if start < 1 || end > n || start > end {
+			return nil, fmt.Errorf("%q is not between 1 and %d", field, n)
+		}
+		for i := start; i <= end; i++ {
+			indexes = append(indexes, i-1)
+		}
+	}
+	slices.Sort(indexes)
+	return slices.Compact(indexes), nil
+}
+
+// formatSelection is the opposite of parseSelection, used to show the default answer.
+func formatSelection(indexes []int, n int) string {
+	switch len(indexes) {
+	case 0:
+		return "none"
+	case n:
+		return "all"
+	}
+	parts := make([]string, len(indexes))
+	for i, index := range indexes {
+		parts[i] = strconv.Itoa(index + 1)
+	}
+	return strings.Join(parts, ",")
+}
+
+// askSelection asks until the answer is a valid selection.
+func (p *terminalPrompt) askSelection(question string, def []int, n int) ([]int, error) {
+	for {
+		answer, err := p.ask(question, formatSelection(def, n))
+		if err != nil {
+			return nil, err
+		}
+		indexes, err := parseSelection(answer, n)
+		if err == nil {
+			return indexes, nil
+		}
+		fmt.Fprintln(p.out, err)
+	}
+}
+
+// parseLocalNames parses answers like "3=Phoenix 5=Docs" into local names by index, "-" resets a name.
+func parseLocalNames(input string, n int) (map[int]string, error) {
+	names := map[int]string{}
+	for _, field := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == ' ' }) {
+		number, name, ok := strings.Cut(field, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q isn't <number>=<name>", field)
+		}
+		i, err := strconv.Atoi(number)
+		if err != nil || i < 1 || i > n {
+			return nil, fmt.Errorf("%q is not between 1 and %d", number, n)
+		}
+		if name == "-" {
+			name = ""
+		}
+		names[i-1] = name
+	}
+	return names, nil
+}
+
+// selectDrives lets the user pick the drives to mount and to mount automatically, starting from the current state.
+// All drives are returned, the ones not picked are disabled like in the web UI.
+// remotes are all remotes in rclone.conf, the local names can't clash with them.
+func (p *terminalPrompt) selectDrives(current []models.Drive, orphans, remotes []string) ([]models.Drive, []string, error) {
+	fmt.Fprintln(p.out, "\nAvailable drives:")
+	var def []int
+	for i, d := range current {
+		mark := ""
+		if d.LocalName != "" {
+			mark = " → " + d.LocalName
+		}
+		if needsRename(d) {
+			def = append(def, i)
+			mark += fmt.Sprintf(" (configured as %s, will be renamed)", d.Remote)
+		} else if d.Enabled {
+			def = append(def, i)
+			mark += " (configured)"
+		}
+		fmt.Fprintf(p.out, "%3d) %s%s\n", i+1, d.Name, mark)
+	}
+	fmt.Fprintln(p.out)
+
+	enabled, err := p.askSelection("Drives to mount, e.g. 1,3-5, all or none", def, len(current))
+	if err != nil {
+		return nil, nil, err
+	}
+	var automount []int
+	if len(enabled) > 0 {
+		// drives that are new are mounted at login by default
+		var defAutomount []int
+		for _, i := range enabled {
+			if current[i].AutoMount || !current[i].Enabled {
+				defAutomount = append(defAutomount, i)
+			}
+		}
+		automount, err = p.askSelection("Drives to mount at login", defAutomount, len(current))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	drives := make([]models.Drive, len(current))
+	for i, d := range current {
+		d.Enabled = slices.Contains(enabled, i)
+		// automount is only applied to enabled drives
+		d.AutoMount = d.Enabled && slices.Contains(automount, i)
+		drives[i] = d
+	}
+
+	var removed []string
+	if len(orphans) > 0 {
+		fmt.Fprintln(p.out, "\nRemotes that don't match any drive you have access to anymore:")
+		for i, name := range orphans {
+			fmt.Fprintf(p.out, "%3d) %s\n", i+1, name)
+		}
+		fmt.Fprintln(p.out)
+		remove, err := p.askSelection("Remotes to remove", nil, len(orphans))
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, i := range remove {
+			removed = append(removed, orphans[i])
+		}
+	}
+
+	reserved := reservedNames(current, remotes, removed)
+	invalid := validateMountNames(drives, reserved)
+	// without mounted drives the names only have to be asked for to resolve a clash
+	for len(enabled) > 0 || invalid != nil {
+		if invalid != nil {
+			fmt.Fprintln(p.out, invalid)
+		}
+		answer, err := p.ask("Local names, e.g. 3=Phoenix, - resets a name", "keep")
+		if err != nil {
+			return nil, nil, err
+		}
+		if answer != "keep" {
+			names, err := parseLocalNames(answer, len(current))
+			if err != nil {
+				fmt.Fprintln(p.out, err)
+				continue
+			}
+			for i, name := range names {
+				drives[i].LocalName = name
+			}
+		}
+		if invalid = validateMountNames(drives, reserved); invalid == nil {
+			break
+		}
+	}
+	return drives, removed, nil
+}
+
+// login prints the login URL and asks for the redirect URL until the code can be exchanged for a token.
+func (p *terminalPrompt) login(ctx context.Context, oauthConfig *oauth2.Config) (*oauth2.Token, error) {
+	state := rand.Text()
+	verifier := oauth2.GenerateVerifier()
+	authURL := oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
+	fmt.Fprintf(p.out, "\nOpen this URL in a browser on any machine and log in:\n\n%s\n\n", authURL)
+	fmt.Fprintf(p.out, "Afterwards the browser is sent to %s, which won't load.\n", oauthConfig.RedirectURL)
+	fmt.Fprintln(p.out, "Copy the whole URL from the address bar and paste it here.")
+
+	for {
+		answer, err := p.ask("Redirect URL or code", "")
+		if err != nil {
+			return nil, err
+		}
+		code, err := parseAuthResponse(answer, state)
+		if err != nil {
+			fmt.Fprintln(p.out, err)
+			continue
+		}
+		token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+		if err != nil {
+			fmt.Fprintf(p.out, "Failed to exchange token: %v\n", err)
+			continue
+		}
+		return token, nil
+	}
+}
+
+// gdriveConfigTerminal runs the same steps as the web UI, but asks for everything in the terminal.
+func gdriveConfigTerminal(ctx context.Context, p *terminalPrompt) error {
+	savedID, savedSecret, err := getCredentials()
+	if err != nil {
+		log.Printf("Failed to get credentials from keyring: %v", err)
+	}
+	clientID, err := p.ask("Client ID", savedID)
+	if err != nil {
+		return err
+	}
+	clientSecret, err := p.askSecret("Client secret", savedSecret)
+	if err != nil {
+		return err
+	}
+	if clientID == "" || clientSecret == "" {
+		return errors.New("missing client_id or client_secret")
+	}
+	if err := setCredentials(clientID, clientSecret); err != nil {
+		log.Printf("Failed to set credentials in keyring: %v", err)
+	}
+
+	oauthConfig := newOAuthConfig(clientID, clientSecret)
+	token, err := p.login(ctx, oauthConfig)
+	if err != nil {
+		return err
+	}
+
+	available, err := checkAvailableDrives(ctx, oauthConfig, token, activeProfile)
+	if err != nil {
+		return fmt.Errorf("failed to check available drives: %w", err)
+	}
+	current, orphans := currentSelection(ctx, available, clientID, activeProfile)
+	drives, removed, err := p.selectDrives(current, orphans, takenNames())
+	if err != nil {
+		return err
+	}
+	if err := applySelection(ctx, drives, removed, clientID, clientSecret, token); err != nil {
+		return err
+	}
+	fmt.Fprintln(p.out, "\nDone, your drives are ready.")
+	return nil
+}
+
+func gdriveConfigNoBrowser(cmd *cobra.Command) {
+	p := newTerminalPrompt(cmd.InOrStdin(), cmd.OutOrStdout())
+	if err := gdriveConfigTerminal(cmd.Context(), p); err != nil {
+		log.Fatalln(err)
+	}
+}
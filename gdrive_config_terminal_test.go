@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAuthResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"redirect url", "http://localhost:53682/auth?state=abc&code=4/xyz&scope=drive", "4/xyz", false},
+		{"query only", "state=abc&code=4/xyz", "4/xyz", false},
+		{"code only", "  4/xyz\n", "4/xyz", false},
+		{"wrong state", "http://localhost:53682/auth?state=other&code=4/xyz", "", true},
+		{"missing code", "http://localhost:53682/auth?state=abc&code=", "", true},
+		{"denied", "http://localhost:53682/auth?error=access_denied&state=abc", "", true},
+		{"empty", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAuthResponse(tt.input, "abc")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []int
+		wantErr bool
+	}{
+		{"all", []int{0, 1, 2, 3, 4}, false},
+		{"none", nil, false},
+		{"", nil, false},
+		{"1", []int{0}, false},
+		{"3-5, 1", []int{0, 2, 3, 4}, false},
+		{"2 2,1-2", []int{0, 1}, false},
+		{"0", nil, true},
+		{"6", nil, true},
+		{"4-2", nil, true},
+		{"x", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseSelection(tt.input, 5)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			roundTrip, err := parseSelection(formatSelection(got, 5), 5)
+			assert.NoError(t, err)
+			assert.Equal(t, got, roundTrip)
+		})
+	}
+}
+
+func TestSelectDrives(t *testing.T) {
+	current := []models.Drive{
+		{Name: "My Drive", ID: "my_drive"},
+		{Name: "Shared With Me", ID: "shared_with_me"},
+		{Name: "Team", ID: "0AB", Enabled: true, Remote: "Team"},
+	}
+	var out bytes.Buffer
+	// invalid answer first, then mount 1 and 3 and only automount 3
+	// the first name is taken by another remote, the second one works
+	p := newTerminalPrompt(strings.NewReader("7\n1,3\n3\n3=Other\n3=T_1\n"), &out)
+
+	drives, removed, err := p.selectDrives(current, nil, []string{"Team", "Other"})
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+	assert.Equal(t, []models.Drive{
+		{Name: "My Drive", ID: "my_drive", Enabled: true},
+		{Name: "Shared With Me", ID: "shared_with_me"},
+		{Name: "Team", ID: "0AB", Enabled: true, AutoMount: true, LocalName: "T_1", Remote: "Team"},
+	}, drives)
+	assert.Contains(t, out.String(), `"Other" is already used by another remote`)
+	assert.Contains(t, out.String(), "3) Team (configured)")
+	assert.Contains(t, out.String(), "mount, e.g. 1,3-5, all or none [3]")
+	// only the new drive is mounted at login by default, Team wasn't before
+	assert.Contains(t, out.String(), "at login [1]")
+}
+
+func TestSelectDrivesDefaults(t *testing.T) {
+	current := []models.Drive{
+		{Name: "My Drive", ID: "my_drive", Enabled: true, AutoMount: true, LocalName: "Home", Remote: "Home"},
+		{Name: "Team", ID: "0AB"},
+		{Name: "New Name", ID: "0CD", Enabled: true, Remote: "Old_Name"},
+	}
+	// keep the drives and names as they are, but remove the orphaned remote
+	var out bytes.Buffer
+	p := newTerminalPrompt(strings.NewReader("\n\n1\n\n"), &out)
+
+	drives, removed, err := p.selectDrives(current, []string{"Old"}, []string{"Home", "Old", "Old_Name"})
+	assert.NoError(t, err)
+	assert.Equal(t, current, drives)
+	assert.Equal(t, []string{"Old"}, removed)
+	assert.Contains(t, out.String(), "3) New Name (configured as Old_Name, will be renamed)")
+}
+
+func TestTerminalPromptAsk(t *testing.T) {
+	var out bytes.Buffer
+	p := newTerminalPrompt(strings.NewReader("\nnew-secret"), &out)
+
+	answer, err := p.ask("Client ID", "saved-id")
+	assert.NoError(t, err)
+	assert.Equal(t, "saved-id", answer)
+	assert.Equal(t, "Client ID [saved-id]: ", out.String())
+
+	// without a terminal the secret is read like any other line
+	secret, err := p.askSecret("Client secret", "saved-secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "new-secret", secret)
+	assert.NotContains(t, out.String(), "saved-secret")
+
+	_, err = p.ask("Anything else", "")
+	assert.Error(t, err)
+}
+
+func TestParseLocalNames(t *testing.T) {
+	names, err := parseLocalNames("3=Phoenix, 1=-", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]string{2: "Phoenix", 0: ""}, names)
+
+	_, err = parseLocalNames("4=Phoenix", 3)
+	assert.Error(t, err)
+	_, err = parseLocalNames("Phoenix", 3)
+	assert.Error(t, err)
+}
@@ -2,58 +2,295 @@ package main
 
 import (
 	"context"
-	"encoding/base64"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
 	"strings"
 	"testing"
 
+	"github.com/adfinis/adfinis-rclone-mgr/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/zalando/go-keyring"
+	drive "google.golang.org/api/drive/v3"
 )
 
+// testBaseURL is what the browser talks to, the server rejects other hosts
+const testBaseURL = "http://localhost:53682"
+
+// startSession opens the login page and returns the session cookie and the CSRF token of the form.
+func startSession(t *testing.T, h http.Handler) (*http.Cookie, string) {
+	req := httptest.NewRequest("GET", testBaseURL+"/", nil)
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusOK, rw.Code)
+
+	cookies := rw.Result().Cookies()
+	if !assert.Len(t, cookies, 1) {
+		t.FailNow()
+	}
+	m := regexp.MustCompile(`name="csrf" value="([^"]+)"`).FindStringSubmatch(rw.Body.String())
+	if !assert.Len(t, m, 2) {
+		t.FailNow()
+	}
+	return cookies[0], m[1]
+}
+
+func postForm(h http.Handler, target string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", testBaseURL+target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	return rw
+}
+
 func TestHttpHandlerRoot(t *testing.T) {
+	keyring.MockInit()
 	h := newHttpHandler(context.Background(), func() {})
-	req := httptest.NewRequest("GET", "/", nil)
+
+	cookie, csrf := startSession(t, h)
+	assert.Equal(t, sessionCookieName, cookie.Name)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+	assert.NotEmpty(t, csrf)
+	assert.NotEqual(t, cookie.Value, csrf)
+}
+
+func TestHttpHandlerRejectsForeignHost(t *testing.T) {
+	h := newHttpHandler(context.Background(), func() {})
+	req := httptest.NewRequest("GET", "http://attacker.example:53682/", nil)
 	rw := httptest.NewRecorder()
 
 	h.ServeHTTP(rw, req)
-	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, http.StatusForbidden, rw.Code)
 }
 
 func TestHttpHandlerLoginMissingFields(t *testing.T) {
+	keyring.MockInit()
 	h := newHttpHandler(context.Background(), func() {})
-	req := httptest.NewRequest("POST", "/login", strings.NewReader(""))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	rw := httptest.NewRecorder()
+	cookie, csrf := startSession(t, h)
 
-	h.ServeHTTP(rw, req)
+	rw := postForm(h, "/login", url.Values{"csrf": {csrf}}, cookie)
 	assert.Equal(t, http.StatusBadRequest, rw.Code)
 }
 
+func TestHttpHandlerLoginCSRF(t *testing.T) {
+	keyring.MockInit()
+	h := newHttpHandler(context.Background(), func() {})
+	cookie, _ := startSession(t, h)
+	form := url.Values{"client_id": {"id"}, "client_secret": {"secret"}}
+
+	// no session
+	rw := postForm(h, "/login", form, nil)
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+
+	// wrong token
+	form.Set("csrf", "wrong")
+	rw = postForm(h, "/login", form, cookie)
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+}
+
+func TestHttpHandlerLoginPKCE(t *testing.T) {
+	keyring.MockInit()
+	h := newHttpHandler(context.Background(), func() {})
+	cookie, csrf := startSession(t, h)
+	otherCookie, otherCSRF := startSession(t, h)
+	form := url.Values{"client_id": {"id"}, "client_secret": {"secret"}}
+
+	form.Set("csrf", csrf)
+	rw := postForm(h, "/login", form, cookie)
+	assert.Equal(t, http.StatusFound, rw.Code)
+	redirect, err := url.Parse(rw.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, "S256", redirect.Query().Get("code_challenge_method"))
+	assert.NotEmpty(t, redirect.Query().Get("code_challenge"))
+	assert.Equal(t, "offline", redirect.Query().Get("access_type"))
+
+	form.Set("csrf", otherCSRF)
+	rw = postForm(h, "/login", form, otherCookie)
+	other, err := url.Parse(rw.Header().Get("Location"))
+	assert.NoError(t, err)
+
+	// every session gets its own state and verifier
+	assert.NotEqual(t, redirect.Query().Get("state"), other.Query().Get("state"))
+	assert.NotEqual(t, redirect.Query().Get("code_challenge"), other.Query().Get("code_challenge"))
+
+	// the credentials stay on the server
+	for _, c := range rw.Result().Cookies() {
+		assert.NotContains(t, c.Value, "secret")
+	}
+}
+
 func TestHttpHandlerAuthInvalidState(t *testing.T) {
 	h := newHttpHandler(context.Background(), func() {})
-	req := httptest.NewRequest("GET", "/auth?state=invalid", nil)
+	req := httptest.NewRequest("GET", testBaseURL+"/auth?state=invalid", nil)
 	rw := httptest.NewRecorder()
 
 	h.ServeHTTP(rw, req)
 	assert.Equal(t, http.StatusBadRequest, rw.Code)
 }
 
-func TestHttpHandlerGenerateMissingToken(t *testing.T) {
+func TestHttpHandlerAuthDenied(t *testing.T) {
+	keyring.MockInit()
 	h := newHttpHandler(context.Background(), func() {})
-	req := httptest.NewRequest("POST", "/generate", nil)
-	rw := httptest.NewRecorder()
+	cookie, csrf := startSession(t, h)
+	rw := postForm(h, "/login", url.Values{"client_id": {"id"}, "client_secret": {"secret"}, "csrf": {csrf}}, cookie)
+	redirect, err := url.Parse(rw.Header().Get("Location"))
+	assert.NoError(t, err)
+	state := redirect.Query().Get("state")
+
+	// the redirect from Google comes without the SameSite=Strict cookie
+	req := httptest.NewRequest("GET", testBaseURL+"/auth?error=access_denied&state="+url.QueryEscape(state), nil)
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Contains(t, rw.Body.String(), "access_denied")
 
+	// the state can only be used once
+	rw = httptest.NewRecorder()
 	h.ServeHTTP(rw, req)
 	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Contains(t, rw.Body.String(), "Invalid state parameter")
+}
+
+func TestHttpHandlerGenerateMissingSession(t *testing.T) {
+	canceled := false
+	h := newHttpHandler(context.Background(), func() { canceled = true })
+
+	rw := postForm(h, "/generate", url.Values{"drive": {"my_drive"}}, nil)
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	// a bad request doesn't stop the server
+	assert.False(t, canceled)
+}
+
+func TestHttpHandlerGenerateCSRF(t *testing.T) {
+	keyring.MockInit()
+	h := newHttpHandler(context.Background(), func() {})
+	cookie, _ := startSession(t, h)
+
+	rw := postForm(h, "/generate", url.Values{"drive": {"my_drive"}}, cookie)
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+}
+
+func TestHttpHandlerGenerateNotLoggedIn(t *testing.T) {
+	keyring.MockInit()
+	h := newHttpHandler(context.Background(), func() {})
+	cookie, csrf := startSession(t, h)
+
+	rw := postForm(h, "/generate", url.Values{"csrf": {csrf}}, cookie)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestSessionStoreByState(t *testing.T) {
+	store := newSessionStore()
+	rw := httptest.NewRecorder()
+	session := store.create(rw)
+	store.startLogin(session, "id", "secret")
+	assert.NotEmpty(t, session.verifier)
+	assert.NotEqual(t, session.csrf, session.state)
+
+	_, ok := store.byState("")
+	assert.False(t, ok)
+	found, ok := store.byState(session.state)
+	assert.True(t, ok)
+	assert.Same(t, session, found)
+
+	store.remove(session)
+	req := httptest.NewRequest("GET", testBaseURL+"/", nil)
+	req.AddCookie(rw.Result().Cookies()[0])
+	_, ok = store.get(req)
+	assert.False(t, ok)
 }
 
-func TestHttpHandlerGenerateMissingOidc(t *testing.T) {
+func TestHttpHandlerStatic(t *testing.T) {
 	h := newHttpHandler(context.Background(), func() {})
-	req := httptest.NewRequest("POST", "/generate", nil)
-	req.AddCookie(&http.Cookie{Name: "token", Value: base64.StdEncoding.EncodeToString([]byte("dummy"))})
+	req := httptest.NewRequest("GET", testBaseURL+"/static/app.css", nil)
 	rw := httptest.NewRecorder()
 
 	h.ServeHTTP(rw, req)
-	assert.Equal(t, http.StatusBadRequest, rw.Code)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Header().Get("Content-Type"), "text/css")
+	assert.Contains(t, rw.Body.String(), ".bg-white")
+}
+
+func TestHttpHandlerContentSecurityPolicy(t *testing.T) {
+	keyring.MockInit()
+	h := newHttpHandler(context.Background(), func() {})
+	req := httptest.NewRequest("GET", testBaseURL+"/", nil)
+	rw := httptest.NewRecorder()
+
+	h.ServeHTTP(rw, req)
+	assert.Contains(t, rw.Header().Get("Content-Security-Policy"), "default-src 'none'")
+	assert.Contains(t, rw.Body.String(), `href="/static/app.css"`)
+	// everything is served locally
+	assert.NotContains(t, rw.Body.String(), "https://")
+}
+
+func TestWithCurrentState(t *testing.T) {
+	drives := []models.Drive{
+		{Name: "My Drive", ID: "my_drive", Remote: "My_Drive"},
+		{Name: "Team", ID: "0AAA", Remote: "Old_Team"},
+		{Name: "New", ID: "0BBB"},
+	}
+	marked := withCurrentState(drives, map[string]driveStatus{
+		"My_Drive": {Remote: true, AutoMount: true},
+		"Old_Team": {Remote: true},
+		// the name of the drive doesn't count, only its remote
+		"New": {Remote: true, AutoMount: true},
+	})
+	assert.Equal(t, []models.Drive{
+		{Name: "My Drive", ID: "my_drive", Enabled: true, AutoMount: true, Remote: "My_Drive"},
+		{Name: "Team", ID: "0AAA", Enabled: true, Remote: "Old_Team"},
+		{Name: "New", ID: "0BBB"},
+	}, marked)
+	// the drives from the API aren't changed
+	assert.False(t, drives[0].Enabled)
+}
+
+func TestOrphanedRemotes(t *testing.T) {
+	drives := []models.Drive{
+		{Name: "My Drive", ID: "my_drive", Remote: "My_Drive"},
+		{Name: "Team", ID: "0AAA", LocalName: "T", Remote: "T"},
+		// the remote called New belongs to a drive that is gone
+		{Name: "New", ID: "0BBB"},
+	}
+	assert.Equal(t, []string{"Team", "New", "Old"}, orphanedRemotes([]string{"My_Drive", "Team", "T", "New", "Old"}, drives))
+	assert.Empty(t, orphanedRemotes([]string{"My_Drive"}, drives))
+}
+
+func TestRemovalsFirst(t *testing.T) {
+	drives := []models.Drive{
+		{Name: "A", Enabled: true},
+		{Name: "B"},
+		{Name: "C", Enabled: true},
+		{Name: "D"},
+	}
+	assert.Equal(t, []models.Drive{drives[1], drives[3], drives[0], drives[2]}, removalsFirst(drives))
+}
+
+func TestListSharedDrives(t *testing.T) {
+	var requests []url.Values
+	service := newTestDriveService(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query())
+		list := drive.DriveList{Drives: []*drive.Drive{{Id: "0AAA", Name: "Team"}}}
+		if r.URL.Query().Get("pageToken") == "" {
+			list.NextPageToken = "next"
+		} else {
+			list.Drives = []*drive.Drive{{Id: "0BBB", Name: "Other"}}
+		}
+		_ = json.NewEncoder(w).Encode(list)
+	})
+
+	drives, err := listSharedDrives(context.Background(), service)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Drive{{Name: "Team", ID: "0AAA"}, {Name: "Other", ID: "0BBB"}}, drives)
+	if assert.Len(t, requests, 2) {
+		assert.Equal(t, "100", requests[0].Get("pageSize"))
+		assert.Equal(t, "nextPageToken, drives(id, name)", requests[0].Get("fields"))
+		assert.Equal(t, "next", requests[1].Get("pageToken"))
+	}
 }
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// idleCheckInterval is how often the activity of the mounts is sampled
+const idleCheckInterval = 5 * time.Minute
+
+// activitySample is what we know about the use of a mount at a point in time.
+type activitySample struct {
+	// Busy is set while files are open or uploads are pending
+	Busy bool
+	// Counter grows with every transfer and check rclone does
+	Counter int64
+	// LastAccess is the newest access or modification time in the VFS cache
+	LastAccess time.Time
+}
+
+// sampleActivity asks rclone about the use of a mount and looks at the access times in its cache.
+func sampleActivity(ctx context.Context, name string) (activitySample, error) {
+	var s activitySample
+	var vfs struct {
+		InUse     int `json:"inUse"`
+		DiskCache struct {
+			UploadsInProgress int `json:"uploadsInProgress"`
+			UploadsQueued     int `json:"uploadsQueued"`
+		} `json:"diskCache"`
+	}
+	if err := rcCall(ctx, name, "vfs/stats", nil, &vfs); err != nil {
+		return s, err
+	}
+	s.Busy = vfs.InUse > 0 || vfs.DiskCache.UploadsInProgress+vfs.DiskCache.UploadsQueued > 0
+
+	var core struct {
+		Bytes     int64 `json:"bytes"`
+		Transfers int64 `json:"transfers"`
+		Checks    int64 `json:"checks"`
+	}
+	if err := rcCall(ctx, name, "core/stats", nil, &core); err != nil {
+		return s, err
+	}
+	s.Counter = core.Bytes + core.Transfers + core.Checks
+	s.LastAccess = lastCacheAccess(getDriveCachePath(name))
+	return s, nil
+}
+
+// lastCacheAccess returns the newest access or modification time of the files in a cache directory.
+// Reads served from the cache don't show up in the rc stats, but they update the access time.
+func lastCacheAccess(dir string) time.Time {
+	var last time.Time
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error { // nolint:errcheck
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		t := info.ModTime()
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			if atime := time.Unix(st.Atim.Unix()); atime.After(t) {
+				t = atime
+			}
+		}
+		if t.After(last) {
+			last = t
+		}
+		return nil
+	})
+	return last
+}
+
+type driveActivity struct {
+	lastActive time.Time
+	counter    int64
+}
+
+// idleTracker remembers when a mount was used last.
+type idleTracker struct {
+	drives map[string]*driveActivity
+}
+
+func newIdleTracker() *idleTracker {
+	return &idleTracker{drives: map[string]*driveActivity{}}
+}
+
+// observe records a sample and returns how long the drive has been idle.
+// A drive seen for the first time counts as active, we don't know what happened before.
+func (t *idleTracker) observe(name string, now time.Time, s activitySample) time.Duration {
+	a, ok := t.drives[name]
+	if !ok {
+		t.drives[name] = &driveActivity{lastActive: now, counter: s.Counter}
+		return 0
+	}
+	if s.Busy || s.Counter != a.counter {
+		a.lastActive = now
+	}
+	a.counter = s.Counter
+	if s.LastAccess.After(a.lastActive) {
+		a.lastActive = s.LastAccess
+	}
+	return now.Sub(a.lastActive)
+}
+
+// forget drops drives that aren't mounted anymore, they start fresh when mounted again.
+func (t *idleTracker) forget(active []string) {
+	for name := range t.drives {
+		if !slices.Contains(active, name) {
+			delete(t.drives, name)
+		}
+	}
+}
+
+// mountPlaceholders watch the empty mountpoints of idle drives and report when they are opened.
+type mountPlaceholders struct {
+	file *os.File
+	fd   int
+
+	mu      sync.Mutex
+	watches map[int]string
+}
+
+func newMountPlaceholders() (*mountPlaceholders, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init inotify: %w", err)
+	}
+	// a non-blocking fd uses the runtime poller, so closing the file ends a pending read
+	return &mountPlaceholders{
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		fd:      fd,
+		watches: map[int]string{},
+	}, nil
+}
+
+func (p *mountPlaceholders) Close() error {
+	return p.file.Close()
+}
+
+// add watches the mountpoint of a drive, IN_OPEN fires as soon as a file manager or shell lists it.
+func (p *mountPlaceholders) add(name, mountPath string) error {
+	wd, err := unix.InotifyAddWatch(p.fd, mountPath, unix.IN_OPEN|unix.IN_ONESHOT)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", mountPath, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.watches[wd] = name
+	return nil
+}
+
+func (p *mountPlaceholders) remove(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for wd, n := range p.watches {
+		if n == name {
+			unix.InotifyRmWatch(p.fd, uint32(wd)) // nolint:errcheck
+			delete(p.watches, wd)
+		}
+	}
+}
+
+func (p *mountPlaceholders) names() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, 0, len(p.watches))
+	for _, n := range p.watches {
+		names = append(names, n)
+	}
+	return names
+}
+
+// run reads the inotify events and calls opened with the name of the drive, until the placeholders are closed.
+func (p *mountPlaceholders) run(opened func(name string)) error {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := p.file.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to read inotify events: %w", err)
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			offset += unix.SizeofInotifyEvent + int(event.Len)
+			if event.Mask&unix.IN_OPEN == 0 {
+				continue
+			}
+			p.mu.Lock()
+			name, ok := p.watches[int(event.Wd)]
+			// IN_ONESHOT removed the watch
+			delete(p.watches, int(event.Wd))
+			p.mu.Unlock()
+			if ok {
+				opened(name)
+			}
+		}
+	}
+}
+
+func setDriveIdle(name string, idle bool) error {
+	return updateState(func(s *managerState) error {
+		s.Idle = slices.DeleteFunc(s.Idle, func(n string) bool { return n == name })
+		if idle {
+			s.Idle = append(s.Idle, name)
+		}
+		return nil
+	})
+}
+
+// unmountIdleDrives stops the drives that weren't used for longer than their idle timeout.
+func (d *mgrDaemon) unmountIdleDrives(ctx context.Context, tracker *idleTracker, p *mountPlaceholders) {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	active, err := activeDrives(ctx, d.sm)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	tracker.forget(active)
+
+	now := time.Now()
+	for _, name := range active {
+		timeout := cfg.drive(name).IdleTimeout
+		if timeout <= 0 {
+			continue
+		}
+		s, err := sampleActivity(ctx, name)
+		if err != nil {
+			log.Printf("Failed to get activity of %q: %v", name, err)
+			continue
+		}
+		idle := tracker.observe(name, now, s)
+		if idle < timeout {
+			continue
+		}
+
+		log.Printf("%q wasn't used for %s, unmounting it", name, idle.Round(time.Minute))
+		if err := stopService(ctx, d.sm, name); err != nil {
+			log.Println(err)
+			continue
+		}
+		if err := setDriveIdle(name, true); err != nil {
+			log.Println(err)
+		}
+		if err := p.add(name, getDriveDataPath(name)); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// syncPlaceholders makes sure exactly the idle drives that aren't mounted are watched.
+// Mounting or unmounting a drive by hand clears its idle flag.
+func (d *mgrDaemon) syncPlaceholders(ctx context.Context, p *mountPlaceholders) {
+	state, err := loadState()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	active, err := activeDrives(ctx, d.sm)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	watched := p.names()
+	for _, name := range watched {
+		if !slices.Contains(state.Idle, name) || slices.Contains(active, name) {
+			p.remove(name)
+		}
+	}
+	for _, name := range state.Idle {
+		if slices.Contains(active, name) {
+			if err := setDriveIdle(name, false); err != nil {
+				log.Println(err)
+			}
+			continue
+		}
+		if !slices.Contains(watched, name) {
+			if err := p.add(name, getDriveDataPath(name)); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+func (d *mgrDaemon) remountIdleDrive(ctx context.Context, name string) {
+	log.Printf("%q was opened, mounting it again", name)
+	if err := setDriveIdle(name, false); err != nil {
+		log.Println(err)
+	}
+	if err := startService(ctx, d.sm, name); err != nil {
+		log.Println(err)
+	}
+}
+
+func (d *mgrDaemon) runIdleUnmount(ctx context.Context) error {
+	p, err := newMountPlaceholders()
+	if err != nil {
+		return err
+	}
+	opened := make(chan string)
+	go func() {
+		err := p.run(func(name string) {
+			select {
+			case opened <- name:
+			case <-ctx.Done():
+			}
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+	defer p.Close() // nolint:errcheck
+
+	tracker := newIdleTracker()
+	d.syncPlaceholders(ctx, p)
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case name := <-opened:
+			d.remountIdleDrive(ctx, name)
+		case <-ticker.C:
+			d.syncPlaceholders(ctx, p)
+			d.unmountIdleDrives(ctx, tracker, p)
+		}
+	}
+}
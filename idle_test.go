@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdleTracker(t *testing.T) {
+	tracker := newIdleTracker()
+	start := time.Date(2025, 6, 2, 8, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Duration(0), tracker.observe("a", start, activitySample{Counter: 10}))
+	assert.Equal(t, time.Hour, tracker.observe("a", start.Add(time.Hour), activitySample{Counter: 10}))
+	// transfers reset the idle time
+	assert.Equal(t, time.Duration(0), tracker.observe("a", start.Add(2*time.Hour), activitySample{Counter: 11}))
+	// so do open files
+	assert.Equal(t, time.Duration(0), tracker.observe("a", start.Add(3*time.Hour), activitySample{Counter: 11, Busy: true}))
+	// and reads from the cache
+	now := start.Add(5 * time.Hour)
+	assert.Equal(t, 30*time.Minute, tracker.observe("a", now, activitySample{Counter: 11, LastAccess: now.Add(-30 * time.Minute)}))
+
+	tracker.forget(nil)
+	assert.Empty(t, tracker.drives)
+}
+
+func TestLastCacheAccess(t *testing.T) {
+	dir := t.TempDir()
+	assert.True(t, lastCacheAccess(dir).IsZero())
+
+	old := time.Date(2025, 6, 2, 8, 0, 0, 0, time.UTC)
+	recent := old.Add(time.Hour)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "vfs", "My_Drive"), 0o755))
+	for name, ts := range map[string]time.Time{"a": old, "b": recent} {
+		p := filepath.Join(dir, "vfs", "My_Drive", name)
+		assert.NoError(t, os.WriteFile(p, []byte(name), 0o644))
+		assert.NoError(t, os.Chtimes(p, ts, ts))
+	}
+	assert.True(t, recent.Equal(lastCacheAccess(dir)))
+}
+
+func TestMountPlaceholders(t *testing.T) {
+	p, err := newMountPlaceholders()
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	assert.NoError(t, p.add("My_Drive", dir))
+	assert.Equal(t, []string{"My_Drive"}, p.names())
+
+	opened := make(chan string, 1)
+	done := make(chan error)
+	go func() { done <- p.run(func(name string) { opened <- name }) }()
+
+	_, err = os.ReadDir(dir)
+	assert.NoError(t, err)
+	select {
+	case name := <-opened:
+		assert.Equal(t, "My_Drive", name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event for opened mountpoint")
+	}
+	// the watch only fires once
+	assert.Empty(t, p.names())
+
+	assert.NoError(t, p.Close())
+	assert.NoError(t, <-done)
+}
+
+func TestManualMountClearsIdle(t *testing.T) {
+	useTempDirs(t)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	assert.NoError(t, setDriveIdle("My_Drive", true))
+
+	statuses, err := listServiceStatuses(ctx, sm, []string{"My_Drive"})
+	assert.NoError(t, err)
+	assert.Equal(t, "idle", statuses[0].Status)
+
+	assert.Empty(t, umountDrives(ctx, sm, []string{"My_Drive"}, false))
+	state, err := loadState()
+	assert.NoError(t, err)
+	assert.Empty(t, state.Idle)
+}
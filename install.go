@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/spf13/cobra"
+)
+
+//go:embed assets/rclone@.service assets/adfinis-rclone-mgr@.service assets/adfinis-rclone-mgr.service assets/adfinis-rclone-mgr-automount.target assets/adfinis-rclone-mgr-discover.service assets/adfinis-rclone-mgr-discover.timer assets/file-exclude-list.txt
+var assetsFS embed.FS
+
+// the paths the packaged assets use, they get replaced with the real paths on install
+const (
+	packagedRclonePath      = "/usr/bin/rclone"
+	packagedManagerPath     = "/usr/bin/adfinis-rclone-mgr"
+	packagedExcludeListPath = excludeListPath
+)
+
+// installPaths are the paths the rendered units point to.
+type installPaths struct {
+	Rclone      string
+	Manager     string
+	ExcludeList string
+}
+
+func getUserUnitDir() string {
+	return path.Join(xdg.ConfigHome, "systemd", "user")
+}
+
+func getUserExcludeListPath() string {
+	return path.Join(xdg.DataHome, "adfinis-rclone-mgr", "file-exclude-list.txt")
+}
+
+// detectInstallPaths finds the binaries the units should run.
+func detectInstallPaths() (installPaths, error) {
+	rclone, err := exec.LookPath("rclone")
+	if err != nil {
+		return installPaths{}, fmt.Errorf("rclone not found in PATH: %w", err)
+	}
+	rclone, err = filepath.Abs(rclone)
+	if err != nil {
+		return installPaths{}, err
+	}
+	manager, err := os.Executable()
+	if err != nil {
+		return installPaths{}, fmt.Errorf("failed to find own binary: %w", err)
+	}
+	// go run builds into a temporary directory, units pointing there break on the next reboot
+	if strings.HasPrefix(manager, os.TempDir()) {
+		return installPaths{}, fmt.Errorf("refusing to install units pointing to the temporary binary %s", manager)
+	}
+	return installPaths{
+		Rclone:      rclone,
+		Manager:     manager,
+		ExcludeList: getUserExcludeListPath(),
+	}, nil
+}
+
+// renderUnit replaces the packaged paths in a unit with the given ones.
+func renderUnit(content []byte, paths installPaths) []byte {
+	r := strings.NewReplacer(
+		packagedManagerPath, paths.Manager,
+		packagedRclonePath, paths.Rclone,
+		packagedExcludeListPath, paths.ExcludeList,
+	)
+	return []byte(r.Replace(string(content)))
+}
+
+// installedFile is a file written by the install command.
+type installedFile struct {
+	Path    string
+	Content []byte
+}
+
+func renderInstallFiles(paths installPaths) ([]installedFile, error) {
+	files := make([]installedFile, 0, len(managedUnits)+1)
+	for _, name := range managedUnits {
+		content, err := assetsFS.ReadFile("assets/" + name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embedded unit %s: %w", name, err)
+		}
+		files = append(files, installedFile{
+			Path:    path.Join(getUserUnitDir(), name),
+			Content: renderUnit(content, paths),
+		})
+	}
+	excludeList, err := assetsFS.ReadFile("assets/file-exclude-list.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded exclude list: %w", err)
+	}
+	files = append(files, installedFile{Path: paths.ExcludeList, Content: excludeList})
+	return files, nil
+}
+
+type installState string
+
+const (
+	installMissing  installState = "missing"
+	installOutdated installState = "outdated"
+	installUpToDate installState = "up to date"
+)
+
+func installedFileState(f installedFile) installState {
+	current, err := os.ReadFile(f.Path)
+	if err != nil {
+		return installMissing
+	}
+	if !bytes.Equal(current, f.Content) {
+		return installOutdated
+	}
+	return installUpToDate
+}
+
+// outdatedUserUnits returns the units installed with the install command that differ from the current version.
+// Units installed by the package aren't checked, the package manager takes care of them.
+func outdatedUserUnits() []string {
+	paths, err := detectInstallPaths()
+	if err != nil {
+		return nil
+	}
+	files, err := renderInstallFiles(paths)
+	if err != nil {
+		return nil
+	}
+	var outdated []string
+	for _, f := range files {
+		if installedFileState(f) == installOutdated {
+			outdated = append(outdated, f.Path)
+		}
+	}
+	return outdated
+}
+
+func install(cmd *cobra.Command, _ []string) {
+	ctx := cmd.Context()
+	paths, err := detectInstallPaths()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	files, err := renderInstallFiles(paths)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	for _, f := range files {
+		state := installedFileState(f)
+		if state == installUpToDate {
+			log.Printf("%s is up to date", f.Path)
+			continue
+		}
+		if err := ensureFolderExists(path.Dir(f.Path)); err != nil {
+			log.Fatalln(err)
+		}
+		if err := os.WriteFile(f.Path, f.Content, 0o644); err != nil {
+			log.Fatalf("Failed to write %s: %v", f.Path, err)
+		}
+		if state == installOutdated {
+			log.Printf("Updated outdated %s", f.Path)
+		} else {
+			log.Printf("Installed %s", f.Path)
+		}
+	}
+
+	sm, err := newServiceManager(ctx)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer sm.Close()
+	if err := sm.Reload(ctx); err != nil {
+		log.Fatalln(err)
+	}
+	if err := sm.EnableUnit(ctx, daemonUnitName); err != nil {
+		log.Fatalln(err)
+	}
+	if err := sm.RestartUnit(ctx, daemonUnitName); err != nil {
+		log.Fatalln(err)
+	}
+	log.Println("Installed units, remount running drives to use the new units")
+}
+
+func uninstall(cmd *cobra.Command, _ []string) {
+	ctx := cmd.Context()
+	sm, err := newServiceManager(ctx)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer sm.Close()
+
+	// enabled drives link to our copy of the template, they need to be enabled again after it's gone
+	var enabled []string
+	for _, name := range getRemotes() {
+		ok, err := isServiceEnabled(ctx, sm, name)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if ok {
+			enabled = append(enabled, name)
+			if err := disableService(ctx, sm, name); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	if err := sm.DisableUnit(ctx, daemonUnitName); err != nil {
+		log.Println(err)
+	}
+	timerState, err := sm.UnitFileState(ctx, discoverTimerName)
+	if err != nil {
+		log.Println(err)
+	}
+	discoverEnabled := timerState == "enabled"
+	if discoverEnabled {
+		if err := sm.DisableUnit(ctx, discoverTimerName); err != nil {
+			log.Println(err)
+		}
+	}
+
+	files := make([]string, 0, len(managedUnits)+1)
+	for _, name := range managedUnits {
+		files = append(files, path.Join(getUserUnitDir(), name))
+	}
+	files = append(files, getUserExcludeListPath())
+	for _, f := range files {
+		if err := os.Remove(f); err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("Failed to remove %s: %v", f, err)
+			}
+			continue
+		}
+		log.Printf("Removed %s", f)
+	}
+
+	if err := sm.Reload(ctx); err != nil {
+		log.Fatalln(err)
+	}
+
+	// fall back to the units of the package, if there are any
+	if _, ok := findUnitFile("rclone@.service", userUnitPaths()); !ok {
+		if len(enabled) > 0 {
+			log.Printf("No packaged units found, the following drives are not mounted automatically anymore: %s", strings.Join(enabled, ", "))
+		}
+		return
+	}
+	for _, name := range enabled {
+		if err := enableService(ctx, sm, name); err != nil {
+			log.Println(err)
+		}
+	}
+	if err := sm.EnableUnit(ctx, daemonUnitName); err != nil {
+		log.Println(err)
+	}
+	if discoverEnabled {
+		if err := sm.EnableUnit(ctx, discoverTimerName); err != nil {
+			log.Println(err)
+		}
+	}
+	log.Println("Switched back to the packaged units")
+}
+
+// warnOutdatedUnits logs a hint if the units installed with the install command are older than the binary.
+func warnOutdatedUnits() {
+	for _, p := range outdatedUserUnits() {
+		log.Printf("%s is outdated, run 'adfinis-rclone-mgr install' to update it", p)
+	}
+}
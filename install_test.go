@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderUnit(t *testing.T) {
+	content, err := assetsFS.ReadFile("assets/rclone@.service")
+	assert.NoError(t, err)
+
+	rendered := string(renderUnit(content, installPaths{
+		Rclone:      "/home/user/.local/bin/rclone",
+		Manager:     "/home/user/go/bin/adfinis-rclone-mgr",
+		ExcludeList: "/home/user/.local/share/adfinis-rclone-mgr/file-exclude-list.txt",
+	}))
+	assert.Contains(t, rendered, "ExecStart=/home/user/.local/bin/rclone mount")
+	assert.Contains(t, rendered, "--exclude-from /home/user/.local/share/adfinis-rclone-mgr/file-exclude-list.txt")
+	assert.NotContains(t, rendered, "/usr/bin/rclone")
+	assert.Equal(t, unitVersion, unitFileVersion(rendered))
+
+	content, err = assetsFS.ReadFile("assets/adfinis-rclone-mgr@.service")
+	assert.NoError(t, err)
+	rendered = string(renderUnit(content, installPaths{Manager: "/home/user/go/bin/adfinis-rclone-mgr"}))
+	assert.Contains(t, rendered, "ExecStart=/home/user/go/bin/adfinis-rclone-mgr journald-reader %I")
+}
+
+func TestInstalledFileState(t *testing.T) {
+	f := installedFile{Path: filepath.Join(t.TempDir(), "rclone@.service"), Content: []byte("new")}
+	assert.Equal(t, installMissing, installedFileState(f))
+
+	assert.NoError(t, os.WriteFile(f.Path, []byte("old"), 0o644))
+	assert.Equal(t, installOutdated, installedFileState(f))
+
+	assert.NoError(t, os.WriteFile(f.Path, []byte("new"), 0o644))
+	assert.Equal(t, installUpToDate, installedFileState(f))
+}
+
+func TestEmbeddedUnitsAreVersioned(t *testing.T) {
+	for _, name := range managedUnits {
+		content, err := assetsFS.ReadFile("assets/" + name)
+		assert.NoError(t, err)
+		assert.Equal(t, unitVersion, unitFileVersion(string(content)), name)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -134,6 +135,52 @@ func shouldTriggerError(entry LogEntry, driveName string) bool {
 	return true
 }
 
+// errorClasses maps message fragments to a coarse error class, used for the metrics.
+// The first matching class wins, so more specific classes need to come first.
+var errorClasses = []struct {
+	class     string
+	fragments []string
+}{
+	{"rate_limit", []string{"rateLimitExceeded", "userRateLimitExceeded", "Error 429", "quotaExceeded"}},
+	{"permission", []string{"insufficientParentPermissions", "insufficientFilePermissions", "Error 403", "permission denied"}},
+	{"network", []string{"no such host", "connection refused", "connection reset", "network is unreachable", "i/o timeout", "TLS handshake timeout"}},
+	// after network, rclone can't fetch a token while offline either
+	{"auth", []string{"invalid_grant", "couldn't fetch token"}},
+	{"upload", []string{"failed to upload"}},
+}
+
+// classifyLogEntry returns the error class of a log entry, or an empty string if it isn't an error.
+func classifyLogEntry(entry LogEntry, driveName string) string {
+	if !strings.Contains(entry.Message, "ERROR") {
+		return ""
+	}
+	if !shouldTriggerError(entry, driveName) {
+		return "ignored"
+	}
+	for _, ec := range errorClasses {
+		for _, f := range ec.fragments {
+			if strings.Contains(entry.Message, f) {
+				return ec.class
+			}
+		}
+	}
+	return "other"
+}
+
+// countError keeps track of the errors per drive and class for the metrics.
+func countError(driveName, class string) error {
+	return updateState(func(s *managerState) error {
+		if s.ErrorCounts == nil {
+			s.ErrorCounts = map[string]map[string]int{}
+		}
+		if s.ErrorCounts[driveName] == nil {
+			s.ErrorCounts[driveName] = map[string]int{}
+		}
+		s.ErrorCounts[driveName][class]++
+		return nil
+	})
+}
+
 var fileNameRegex = regexp.MustCompile(`ERROR\s+:\s+(.+?):\s`)
 
 func fileNameFromEntry(entry LogEntry) string {
@@ -150,6 +197,13 @@ func shouldTriggerFileMove(entry LogEntry) bool {
 }
 
 func handleLogEntry(entry LogEntry, driveName string) {
+	class := classifyLogEntry(entry, driveName)
+	if class != "" {
+		if err := countError(driveName, class); err != nil {
+			fmt.Printf("Failed to count error: %v\n", err)
+		}
+	}
+
 	if !shouldTriggerError(entry, driveName) {
 		fmt.Println("Ignoring log entry:", entry.Message)
 		return
@@ -161,6 +215,18 @@ func handleLogEntry(entry LogEntry, driveName string) {
 		return
 	}
 
+	// errors are expected while offline, the daemon refreshes the mount once we are back
+	if isOffline() {
+		fmt.Println("Offline, not notifying about error:", entry.Message)
+		return
+	}
+
+	// every operation fails once the login expired, ask once to log in again instead
+	if class == "auth" {
+		requestReauth(entry, driveName)
+		return
+	}
+
 	// just send a notification
 	title := fmt.Sprintf("Drive Error: %s", driveName)
 	message := fmt.Sprintf("The following error occurred:\n\n%s", entry.Message)
@@ -171,6 +237,24 @@ func handleLogEntry(entry LogEntry, driveName string) {
 	fmt.Println("Notified about error:", entry.Message)
 }
 
+// requestReauth asks to log in again to the account of the drive, unless the reader of another drive of it asked already.
+func requestReauth(entry LogEntry, driveName string) {
+	claimed, err := claimAuthPrompt(remoteProfile(driveName), time.Now())
+	if err != nil {
+		fmt.Printf("Failed to claim login prompt: %v\n", err)
+		return
+	}
+	if !claimed {
+		fmt.Println("Asked to log in again already, ignoring:", entry.Message)
+		return
+	}
+	if err := startReauthPrompt(driveName); err != nil {
+		fmt.Printf("Failed to ask to log in again: %v\n", err)
+		return
+	}
+	fmt.Println("Asked to log in again because of:", entry.Message)
+}
+
 func requestFileMove(entry LogEntry, driveName string) {
 	fileName := fileNameFromEntry(entry)
 	filePath := fileNameToPath(driveName, fileName)
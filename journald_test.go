@@ -217,3 +217,26 @@ func TestShouldTriggerFileMove(t *testing.T) {
 		assert.Equalf(t, tt.want, got, "%s: shouldTriggerFileMove() = %v, want %v", tt.name, got, tt.want)
 	}
 }
+
+func TestClassifyLogEntry(t *testing.T) {
+	for _, test := range []struct {
+		message string
+		drive   string
+		want    string
+	}{
+		{"INFO : vfs cache: cleaned", "my_drive", ""},
+		{"ERROR : Failed to copy: googleapi: Error 403: Insufficient permissions, insufficientParentPermissions", "my_drive", "ignored"},
+		{"ERROR : test: vfs cache: failed to upload try #3: googleapi: Error 403: Insufficient permissions for the specified parent., insufficientParentPermissions", "my_drive", "permission"},
+		{"ERROR : test: googleapi: Error 403: User Rate Limit Exceeded, userRateLimitExceeded", "my_drive", "rate_limit"},
+		{"ERROR : test: Get \"https://www.googleapis.com/drive/v3/files\": dial tcp: lookup www.googleapis.com: no such host", "my_drive", "network"},
+		{"ERROR : test: vfs cache: failed to upload try #1: some other error", "my_drive", "upload"},
+		{"ERROR : : error reading source root directory: couldn't list directory: Get \"https://www.googleapis.com/drive/v3/files\": couldn't fetch token: invalid_grant: maybe token expired? - try refreshing with \"rclone config reconnect My_Drive:\"", "my_drive", "auth"},
+		{"ERROR : test: oauth2: cannot fetch token: 400 Bad Request Response: {\"error\": \"invalid_grant\", \"error_description\": \"Token has been expired or revoked.\"}", "my_drive", "auth"},
+		// offline it's not the login that is wrong
+		{"ERROR : test: couldn't fetch token: Post \"https://oauth2.googleapis.com/token\": dial tcp: lookup oauth2.googleapis.com: no such host", "my_drive", "network"},
+		{"ERROR : something else", "my_drive", "other"},
+	} {
+		got := classifyLogEntry(LogEntry{Message: test.message}, test.drive)
+		assert.Equalf(t, test.want, got, "classifyLogEntry(%q)", test.message)
+	}
+}
@@ -6,12 +6,13 @@ import (
 
 const keyringService = "adfinis-rclone-mgr"
 
+// getCredentials returns the client of the active profile.
 func getCredentials() (clientID string, clientSecret string, err error) {
-	clientID, err = keyring.Get(keyringService, "client_id")
+	clientID, err = keyring.Get(profileKeyringService(activeProfile), "client_id")
 	if err != nil {
 		return
 	}
-	clientSecret, err = keyring.Get(keyringService, "client_secret")
+	clientSecret, err = keyring.Get(profileKeyringService(activeProfile), "client_secret")
 	if err != nil {
 		return
 	}
@@ -19,11 +20,20 @@ func getCredentials() (clientID string, clientSecret string, err error) {
 }
 
 func setCredentials(clientID string, clientSecret string) error {
-	if err := keyring.Set(keyringService, "client_id", clientID); err != nil {
+	if err := keyring.Set(profileKeyringService(activeProfile), "client_id", clientID); err != nil {
 		return err
 	}
-	if err := keyring.Set(keyringService, "client_secret", clientSecret); err != nil {
+	if err := keyring.Set(profileKeyringService(activeProfile), "client_secret", clientSecret); err != nil {
 		return err
 	}
 	return nil
 }
+
+// getToken returns the OAuth token saved by the last gdrive-config, as JSON.
+func getToken() (string, error) {
+	return keyring.Get(profileKeyringService(activeProfile), "token")
+}
+
+func setToken(token string) error {
+	return keyring.Set(profileKeyringService(activeProfile), "token", token)
+}
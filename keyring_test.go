@@ -21,3 +21,15 @@ func TestCredentialGetAndSet(t *testing.T) {
 	assert.Equal(t, clientID, retrievedClientID)
 	assert.Equal(t, clientSecret, retrievedClientSecret)
 }
+
+func TestTokenGetAndSet(t *testing.T) {
+	keyring.MockInit()
+
+	_, err := getToken()
+	assert.ErrorIs(t, err, keyring.ErrNotFound)
+
+	assert.NoError(t, setToken(`{"access_token":"a"}`))
+	token, err := getToken()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"access_token":"a"}`, token)
+}
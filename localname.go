@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+)
+
+// maxLocalNameLength keeps mountpoints and unit names readable
+const maxLocalNameLength = 64
+
+// localNamePattern matches names that work as remote, directory and unit name.
+// systemd turns '-' in the instance name into '/' for %I, so the unit would mount the wrong path, it's left out.
+// templates/static/select.js checks the same while typing.
+var localNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._]*$`)
+
+// validateLocalName checks a name chosen for a drive.
+func validateLocalName(name string) error {
+	if len(name) > maxLocalNameLength {
+		return fmt.Errorf("%q is longer than %d characters", name, maxLocalNameLength)
+	}
+	if !localNamePattern.MatchString(name) {
+		return fmt.Errorf("%q may only contain letters, digits, '.' and '_' and has to start with a letter or digit", name)
+	}
+	return nil
+}
+
+// validateMountNames checks the local names of the drives and makes sure no enabled drive shares its mount name.
+// Disabled drives count as well, removing them would remove the remote of the other drive.
+// reserved are the names of other remotes.
+func validateMountNames(drives []models.Drive, reserved []string) error {
+	var errs []error
+	byName := map[string][]models.Drive{}
+	var names []string
+	for _, d := range drives {
+		if d.LocalName != "" {
+			if err := validateLocalName(d.LocalName); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		name := driveMountName(d)
+		if _, ok := byName[name]; !ok {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], d)
+	}
+	for _, name := range names {
+		group := byName[name]
+		if !slices.ContainsFunc(group, func(d models.Drive) bool { return d.Enabled }) {
+			continue
+		}
+		if len(group) > 1 {
+			errs = append(errs, fmt.Errorf("%q and %q would both be mounted as %q", group[0].Name, group[1].Name, name))
+		} else if slices.Contains(reserved, name) {
+			errs = append(errs, fmt.Errorf("%q is already used by another remote", name))
+		}
+	}
+	return joinErrors("Invalid names", errs)
+}
+
+// reservedNames returns the remotes that don't belong to any of the drives and aren't removed.
+// The remote of a drive is free to use, it's renamed if the drive gets another name.
+func reservedNames(current []models.Drive, remotes, removed []string) []string {
+	var reserved []string
+	for _, name := range remotes {
+		if slices.Contains(removed, name) {
+			continue
+		}
+		if slices.ContainsFunc(current, func(d models.Drive) bool { return d.Remote == name }) {
+			continue
+		}
+		reserved = append(reserved, name)
+	}
+	return reserved
+}
+
+// applyLocalNames sets the stored local names on drives that don't have one.
+func applyLocalNames(drives []models.Drive, names map[string]string) []models.Drive {
+	named := slices.Clone(drives)
+	for i := range named {
+		if named[i].LocalName == "" {
+			named[i].LocalName = names[named[i].ID]
+		}
+	}
+	return named
+}
+
+// setLocalName stores the local name of a drive, an empty name removes it.
+func (c *managerConfig) setLocalName(id, name string) {
+	if name == "" {
+		delete(c.LocalNames, id)
+		return
+	}
+	if c.LocalNames == nil {
+		c.LocalNames = map[string]string{}
+	}
+	c.LocalNames[id] = name
+}
+
+// localNameKey is the key of a local name in the config, every profile has its own My Drive.
+func localNameKey(profile, id string) string {
+	if profile == "" {
+		return id
+	}
+	return profile + "/" + id
+}
+
+// saveLocalNames stores the local names of the drives of the active profile, so the next run keeps them.
+func saveLocalNames(drives []models.Drive) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	for _, d := range drives {
+		if d.ID != "" {
+			cfg.setLocalName(localNameKey(activeProfile, d.ID), d.LocalName)
+		}
+	}
+	return cfg.save()
+}
+
+// loadLocalNames returns the stored local names of the active profile by drive ID, a broken config only loses the names.
+func loadLocalNames() map[string]string {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	names := map[string]string{}
+	for key, name := range cfg.LocalNames {
+		profile, id, ok := strings.Cut(key, "/")
+		if !ok {
+			profile, id = "", key
+		}
+		if profile == activeProfile {
+			names[id] = name
+		}
+	}
+	return names
+}
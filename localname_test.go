@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLocalName(t *testing.T) {
+	for _, name := range []string{"Phoenix", "ACME_Phoenix_2023", "a.b", "1st"} {
+		assert.NoError(t, validateLocalName(name), name)
+	}
+	for _, name := range []string{"", "-x", "a-b", ".hidden", "a b", "a/b", "Zürich", "a%b", string(make([]byte, 65))} {
+		assert.Error(t, validateLocalName(name), name)
+	}
+}
+
+func TestValidateMountNames(t *testing.T) {
+	drives := []models.Drive{
+		{Name: "My Drive", ID: "my_drive", Enabled: true},
+		{Name: "A/B", ID: "0AAA", Enabled: true},
+		{Name: "A_B", ID: "0BBB"},
+		{Name: "C", ID: "0CCC"},
+		{Name: "D", ID: "0DDD"},
+	}
+	err := validateMountNames(drives, nil)
+	assert.ErrorContains(t, err, `"A/B" and "A_B" would both be mounted as "A_B"`)
+
+	drives[2].LocalName = "AB"
+	assert.NoError(t, validateMountNames(drives, nil))
+
+	// disabled drives can clash with each other and other remotes, they aren't set up
+	drives[3].LocalName = "D"
+	assert.NoError(t, validateMountNames(drives, []string{"D"}))
+
+	drives[0].LocalName = "Other"
+	assert.ErrorContains(t, validateMountNames(drives, []string{"Other"}), `"Other" is already used by another remote`)
+
+	drives[0].LocalName = "no spaces"
+	assert.ErrorContains(t, validateMountNames(drives, nil), "may only contain")
+}
+
+func TestReservedNames(t *testing.T) {
+	current := []models.Drive{
+		{Name: "My Drive", ID: "my_drive", Enabled: true, Remote: "My_Drive"},
+		{Name: "Team", ID: "0AAA", LocalName: "T", Enabled: true, Remote: "T"},
+		// renamed in Google Drive, the old name is free once it's renamed
+		{Name: "Renamed", ID: "0CCC", Enabled: true, Remote: "Before"},
+		// same name, but the remote belongs to another drive
+		{Name: "New", ID: "0BBB"},
+	}
+	remotes := []string{"My_Drive", "T", "Team", "Before", "New", "Old", "s3"}
+	assert.Equal(t, []string{"Team", "New", "s3"}, reservedNames(current, remotes, []string{"Old"}))
+}
+
+func TestLocalNamesConfig(t *testing.T) {
+	useTempDirs(t)
+
+	assert.NoError(t, saveLocalNames([]models.Drive{
+		{Name: "Customer ACME – Project Phoenix (2023)", ID: "0AAA", LocalName: "Phoenix"},
+		{Name: "My Drive", ID: "my_drive"},
+	}))
+	names := loadLocalNames()
+	assert.Equal(t, map[string]string{"0AAA": "Phoenix"}, names)
+
+	drives := applyLocalNames([]models.Drive{{Name: "Phoenix long", ID: "0AAA"}, {Name: "Other", ID: "0BBB", LocalName: "O"}}, names)
+	assert.Equal(t, "Phoenix", drives[0].LocalName)
+	assert.Equal(t, "O", drives[1].LocalName)
+
+	// an empty name goes back to the name in Google Drive
+	assert.NoError(t, saveLocalNames([]models.Drive{{Name: "Phoenix long", ID: "0AAA"}}))
+	assert.Empty(t, loadLocalNames())
+}
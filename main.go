@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	mcobra "github.com/muesli/mango-cobra"
 	"github.com/muesli/roff"
@@ -44,26 +45,69 @@ func init() {
 		mountCmd,
 		umountCmd,
 		listCmd,
+		renameCmd,
+		discoverCmd,
+		addFolderCmd,
+		reauthCmd,
+		bandwidthCmd,
+		daemonCmd,
+		superviseCmd,
+		metricsCmd,
+		doctorCmd,
+		installCmd,
+		uninstallCmd,
 		journaldReaderCmd,
 		versionCmd,
 		manCmd,
 	)
 }
 
+var gdriveConfigCmdFlags struct {
+	NoBrowser bool
+	From      string
+	DryRun    bool
+	Profile   string
+}
+
+func init() {
+	gdriveConfigCmd.Flags().BoolVar(&gdriveConfigCmdFlags.NoBrowser, "no-browser", false, "Run the whole configuration in the terminal, e.g. over SSH")
+	gdriveConfigCmd.Flags().StringVar(&gdriveConfigCmdFlags.From, "from", "", "Set up the drives listed in a YAML file without any interaction")
+	gdriveConfigCmd.Flags().BoolVar(&gdriveConfigCmdFlags.DryRun, "dry-run", false, "Only show what --from would change")
+	addProfileFlag(gdriveConfigCmd, &gdriveConfigCmdFlags.Profile, "Profile to configure, each profile is another Google account")
+
+	gdriveConfigCmd.MarkFlagsMutuallyExclusive("no-browser", "from")
+	if err := gdriveConfigCmd.MarkFlagFilename("from", "yaml", "yml"); err != nil {
+		log.Fatalln(err)
+	}
+}
+
 var gdriveConfigCmd = &cobra.Command{
 	Use:   "gdrive-config",
 	Short: "Generate an rclone config for Google Drive",
 	Long: "The gdrive-config command generates an rclone config for Google Drive.\n" +
 		"It will open a browser window to authenticate with Google Drive.\n" +
+		"Use --no-browser to do everything in the terminal, you only have to open the printed URL in a browser on any machine.\n" +
+		"Use --from <file.yaml> to set up the drives listed in the file with the token of a previous login, see the README for the format.\n" +
 		"After authentication, it will generate a config file for rclone.\n" +
 		"The config file will be saved in the default location for rclone configs (~/.config/rclone/rclone.conf).\n" +
-		"Existing rclone remotes won't be overwritten unless the name conflicts with the name of a Google Drive.\n",
+		"Drives are tracked by their ID, a drive renamed in Google Drive is renamed locally as well, including its mountpoint and cache.\n" +
+		"Existing rclone remotes of other drives are never overwritten, pick a local name if a name is taken.\n" +
+		"Use --profile <name> to add another Google account, e.g. the Workspace of a customer.\n" +
+		"A profile has its own client and token in the keyring, its remotes are prefixed with '<name>_' and mounted at ~/google/<name>/<drive>.\n",
 	Run: gdriveConfig,
 	CompletionOptions: cobra.CompletionOptions{
 		HiddenDefaultCmd: true,
 	},
 }
 
+var mountCmdFlags struct {
+	Profile string
+}
+
+func init() {
+	addProfileFlag(mountCmd, &mountCmdFlags.Profile, "Only mount drives of this profile, 'default' for the drives without a profile")
+}
+
 var mountCmd = &cobra.Command{
 	Use:   "mount",
 	Short: "Mount a drive",
@@ -71,6 +115,7 @@ var mountCmd = &cobra.Command{
 		"Use 'mount all' to mount all drives at once.\n" +
 		"Use 'mount <drive>' to mount a specific drive.\n" +
 		"Use 'mount <drive1> <drive2>' to mount multiple drives at once.\n" +
+		"Use 'mount --profile <name> all' to mount all drives of a profile, the drives can be given without the prefix of the profile.\n" +
 		"You can use tab completion to see all available drives.\n",
 	CompletionOptions: cobra.CompletionOptions{
 		DisableDefaultCmd: true,
@@ -81,11 +126,13 @@ var mountCmd = &cobra.Command{
 }
 
 var umountCmdFlags struct {
-	Force bool
+	Force   bool
+	Profile string
 }
 
 func init() {
 	umountCmd.Flags().BoolVarP(&umountCmdFlags.Force, "force", "f", false, "Force unmount the drive(s)")
+	addProfileFlag(umountCmd, &umountCmdFlags.Profile, "Only umount drives of this profile, 'default' for the drives without a profile")
 }
 
 var umountCmd = &cobra.Command{
@@ -95,6 +142,7 @@ var umountCmd = &cobra.Command{
 		"Use 'umount all' to umount all drives at once.\n" +
 		"Use 'umount <drive>' to umount a specific drive.\n" +
 		"Use 'umount <drive1> <drive2>' to umount multiple drives at once.\n" +
+		"Use 'umount --profile <name> all' to umount all drives of a profile, the drives can be given without the prefix of the profile.\n" +
 		"You can use tab completion to see all available drives.\n",
 	CompletionOptions: cobra.CompletionOptions{
 		DisableDefaultCmd: true,
@@ -105,21 +153,253 @@ var umountCmd = &cobra.Command{
 }
 
 var listCmdFlags struct {
-	JSON bool
-	YAML bool
+	JSON    bool
+	YAML    bool
+	Profile string
 }
 
 func init() {
 	listCmd.Flags().BoolVarP(&listCmdFlags.JSON, "json", "j", false, "Output in JSON format")
 	listCmd.Flags().BoolVarP(&listCmdFlags.YAML, "yaml", "y", false, "Output in YAML format")
+	addProfileFlag(listCmd, &listCmdFlags.Profile, "Only list drives of this profile, 'default' for the drives without a profile")
 
 	listCmd.MarkFlagsMutuallyExclusive("json", "yaml")
 }
 
 var listCmd = &cobra.Command{
-	Use:   "ls",
-	Short: "List all available mounts and their status",
-	Run:   list,
+	Use:     "ls",
+	Aliases: []string{"status"},
+	Short:   "List all available mounts and their status",
+	Run:     list,
+}
+
+var renameCmd = &cobra.Command{
+	Use:   "rename <drive> <new-name>",
+	Short: "Rename a drive",
+	Long: "The rename command renames the remote of a drive together with its mountpoint, cache, systemd unit and settings.\n" +
+		"A mounted drive is unmounted for the rename and mounted again under the new name, pending uploads are kept.\n" +
+		"The new name is kept as local name of the drive by gdrive-config.\n" +
+		"gdrive-config renames drives the same way if they were renamed in Google Drive.\n",
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: renameArgs,
+	Run:               rename,
+}
+
+var discoverCmdFlags struct {
+	Notify  bool
+	Profile string
+}
+
+func init() {
+	discoverCmd.Flags().BoolVarP(&discoverCmdFlags.Notify, "notify", "n", false, "Show desktop notifications and offer to add new drives")
+	addProfileFlag(discoverCmd, &discoverCmdFlags.Profile, "Only look at the drives of this profile instead of all profiles")
+}
+
+var discoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "Look for new shared drives",
+	Long: "The discover command lists the shared drives you were added to and the drives you lost access to since gdrive-config last showed them.\n" +
+		"It uses the token of the last login, like 'gdrive-config --from'.\n" +
+		"With --notify it shows desktop notifications instead and new drives can be added and mounted with one click.\n" +
+		"Drives are only notified about once, the first run with --notify only remembers the drives there are.\n" +
+		"Enable adfinis-rclone-mgr-discover.timer to look for new drives regularly.\n" +
+		"All profiles are looked at, unless one is picked with --profile.\n",
+	Args: cobra.NoArgs,
+	Run:  discover,
+}
+
+var addFolderCmdFlags struct {
+	Name    string
+	Profile string
+}
+
+func init() {
+	addFolderCmd.Flags().StringVar(&addFolderCmdFlags.Name, "name", "", "Name of the remote and mountpoint instead of the folder name")
+	addProfileFlag(addFolderCmd, &addFolderCmdFlags.Profile, "Profile whose Google account the folder is in")
+}
+
+var addFolderCmd = &cobra.Command{
+	Use:   "add-folder <drive-url-or-folder-id>",
+	Short: "Mount a single folder as its own drive",
+	Long: "The add-folder command sets up a remote rooted at a folder of Google Drive, with its own mountpoint and systemd unit.\n" +
+		"The folder can be given by its URL, e.g. https://drive.google.com/drive/folders/<id>, or by its ID.\n" +
+		"It uses the token of the last login, like 'gdrive-config --from'.\n" +
+		"gdrive-config lists the folder like a drive afterwards, it can be disabled or renamed there.\n",
+	Args: cobra.ExactArgs(1),
+	Run:  addFolder,
+}
+
+var reauthCmdFlags struct {
+	NoBrowser bool
+	Check     bool
+	Expired   string
+	Profile   string
+}
+
+func init() {
+	reauthCmd.Flags().BoolVar(&reauthCmdFlags.NoBrowser, "no-browser", false, "Log in through the terminal, e.g. over SSH")
+	reauthCmd.Flags().BoolVar(&reauthCmdFlags.Check, "check", false, "Only check whether the remotes share a working token")
+	addProfileFlag(reauthCmd, &reauthCmdFlags.Profile, "Profile to log in again")
+
+	reauthCmd.Flags().StringVar(&reauthCmdFlags.Expired, "expired", "", "Ask first and renew the login of the account of this remote, used by the journald reader")
+	_ = reauthCmd.Flags().MarkHidden("expired")
+
+	reauthCmd.MarkFlagsMutuallyExclusive("no-browser", "check")
+	reauthCmd.MarkFlagsMutuallyExclusive("no-browser", "expired")
+	// the profile of the remote is used
+	reauthCmd.MarkFlagsMutuallyExclusive("profile", "expired")
+}
+
+var reauthCmd = &cobra.Command{
+	Use:   "reauth",
+	Short: "Log in again and renew the token of all drives",
+	Long: "The reauth command only runs the login of gdrive-config and writes the new token into every remote of the account.\n" +
+		"Mounted drives are restarted to use it, the drive selection stays as it is.\n" +
+		"Use it when Google revoked the login or the remotes ended up with different tokens.\n" +
+		"With --check it only shows which remotes share a token and whether Google still accepts it.\n" +
+		"When the login expires, the journald reader asks once whether to log in again and runs reauth.\n",
+	Args: cobra.NoArgs,
+	Run:  reauth,
+}
+
+func init() {
+	bandwidthSetCmd.Flags().DurationVar(&bandwidthSetCmdFlags.Duration, "for", 0, "Remove the limit again after this duration, e.g. 2h")
+	bandwidthScheduleCmd.Flags().BoolVar(&bandwidthScheduleCmdFlags.Clear, "clear", false, "Remove the bandwidth schedule of the drive")
+
+	bandwidthCmd.AddCommand(
+		bandwidthSetCmd,
+		bandwidthResetCmd,
+		bandwidthScheduleCmd,
+	)
+}
+
+var bandwidthCmd = &cobra.Command{
+	Use:   "bwlimit",
+	Short: "Manage bandwidth limits of drives",
+	Long: "The bwlimit command lets you limit the bandwidth rclone uses for your drives.\n" +
+		"Use 'bwlimit schedule <drive> <timetable>' to configure a permanent schedule, e.g. \"08:00,512k 18:00,off\".\n" +
+		"Use 'bwlimit set <rate>' to temporarily override the limit of all drives, e.g. 'bwlimit set 1M --for 2h'.\n" +
+		"The limits are applied to running mounts by the daemon, use 'ls' to see the current limits.\n",
+}
+
+var bandwidthSetCmdFlags struct {
+	Duration time.Duration
+}
+
+var bandwidthSetCmd = &cobra.Command{
+	Use:   "set <rate> [drive...]",
+	Short: "Temporarily override the bandwidth limit",
+	Long: "The set command overrides the bandwidth limit of the given drives, or of all drives if none are given.\n" +
+		"The rate uses the rclone --bwlimit format, e.g. '1M', '512k:off' (upload:download) or 'off'.\n" +
+		"The override lasts until 'bwlimit reset' or until the duration given with --for is over.\n",
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: availableMountsForArgs,
+	Run:               bandwidthSet,
+}
+
+var bandwidthResetCmd = &cobra.Command{
+	Use:               "reset [drive...]",
+	Short:             "Remove temporary bandwidth overrides",
+	ValidArgsFunction: availableMountsForArgs,
+	Run:               bandwidthReset,
+}
+
+var bandwidthScheduleCmdFlags struct {
+	Clear bool
+}
+
+var bandwidthScheduleCmd = &cobra.Command{
+	Use:   "schedule <drive> [timetable]",
+	Short: "Show or configure the bandwidth schedule of a drive",
+	Long: "The schedule command shows or sets the bandwidth schedule of a drive.\n" +
+		"The timetable uses the rclone --bwlimit format, e.g. \"08:00,512k 18:00,off\" or \"Mon-08:00,1M Sat-00:00,off\".\n",
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: availableMountsForArgs,
+	Run:               bandwidthSchedule,
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Daemon managing all mounts of the user",
+	Long: "The daemon is started by adfinis-rclone-mgr.service and keeps an eye on all mounts.\n" +
+		"At login it mounts the drives set to automount as soon as the network is up.\n" +
+		"It applies the bandwidth limits to running mounts and watches NetworkManager for connectivity changes.\n" +
+		"Before suspend it flushes pending uploads, after resume it restarts mounts that hang.\n" +
+		"A watchdog checks the mounts regularly and marks the ones that stop responding as unhealthy.\n" +
+		"Drives with an idle timeout are unmounted when unused and mounted again when their folder is opened.\n",
+	Args: cobra.NoArgs,
+	Run:  runDaemon,
+}
+
+var superviseCmd = &cobra.Command{
+	Use:   "supervise",
+	Short: "Run the mounts without systemd",
+	Long: "The supervise command is a fallback for systems without a systemd user instance, e.g. toolbox or distrobox containers.\n" +
+		"It runs rclone with the same arguments as rclone@.service and restarts crashed mounts with a backoff.\n" +
+		"Errors in the rclone log are handled like the journald reader does it, and the daemon components run as part of it.\n" +
+		"The mount, umount and ls commands talk to it automatically if systemd isn't available.\n" +
+		"Run it in the background of your session, e.g. from your shell profile.\n",
+	Args: cobra.NoArgs,
+	Run:  supervise,
+}
+
+var metricsCmdFlags struct {
+	Listen   string
+	Textfile string
+	Interval time.Duration
+}
+
+func init() {
+	metricsCmd.Flags().StringVarP(&metricsCmdFlags.Listen, "listen", "l", "127.0.0.1:9637", "Address to serve the metrics on, empty to disable the server")
+	metricsCmd.Flags().StringVarP(&metricsCmdFlags.Textfile, "textfile", "t", "", "Also write the metrics to this file, e.g. for the node_exporter textfile collector")
+	metricsCmd.Flags().DurationVarP(&metricsCmdFlags.Interval, "interval", "i", time.Minute, "Interval to write the textfile in")
+}
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Serve Prometheus metrics about the drives",
+	Long: "The metrics command serves Prometheus metrics about all drives on http://127.0.0.1:9637/metrics.\n" +
+		"It exposes the mount state, unit restarts, errors by class, cache usage, pending uploads and throughput.\n" +
+		"Use --textfile to write the metrics to a file for the node_exporter textfile collector instead,\n" +
+		"e.g. 'metrics --listen \"\" --textfile /var/lib/node_exporter/textfile/rclone.prom'.\n",
+	Args: cobra.NoArgs,
+	Run:  serveMetrics,
+}
+
+var doctorCmdFlags struct {
+	JSON bool
+}
+
+func init() {
+	doctorCmd.Flags().BoolVarP(&doctorCmdFlags.JSON, "json", "j", false, "Output in JSON format")
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the local environment for common problems",
+	Long: "The doctor command checks everything adfinis-rclone-mgr needs to work and suggests a fix for every problem.\n" +
+		"It checks rclone, fuse, the systemd units, the exclude list, the keyring, the rclone config, the mountpoints and notifications.\n" +
+		"It exits with a non-zero status if any check fails.\n",
+	Args: cobra.NoArgs,
+	Run:  doctor,
+}
+
+var installCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the systemd user units for the current user",
+	Long: "The install command writes the systemd units to ~/.config/systemd/user and the exclude list to ~/.local/share/adfinis-rclone-mgr.\n" +
+		"The units point to the rclone and adfinis-rclone-mgr binaries found on this system, e.g. in ~/.local/bin or ~/go/bin.\n" +
+		"This is only needed if you didn't install adfinis-rclone-mgr with a package.\n" +
+		"Run it again after an upgrade to update outdated units.\n",
+	Args: cobra.NoArgs,
+	Run:  install,
+}
+
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the systemd user units written by install",
+	Args:  cobra.NoArgs,
+	Run:   uninstall,
 }
 
 var journaldReaderCmd = &cobra.Command{
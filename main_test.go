@@ -24,6 +24,13 @@ func TestRootCmd_HasSubcommands(t *testing.T) {
 		"mount",
 		"umount",
 		"ls",
+		"bwlimit",
+		"daemon",
+		"supervise",
+		"metrics",
+		"doctor",
+		"install",
+		"uninstall",
 		"journald-reader",
 		"version",
 		"man",
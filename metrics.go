@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+)
+
+const metricsNamespace = "adfinis_rclone_mgr"
+
+// driveMetrics is a snapshot of everything we export about a drive.
+type driveMetrics struct {
+	Name     string
+	State    string
+	Restarts uint32
+	Errors   map[string]int
+	// the following are only known while the drive is mounted
+	CacheBytes     int64
+	PendingUploads int
+	Bytes          int64
+	Speed          float64
+}
+
+var (
+	driveMountedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "drive", "mounted"),
+		"Whether the drive is mounted.",
+		[]string{"drive"}, nil,
+	)
+	driveStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "drive", "state"),
+		"Current systemd state of the drive's mount unit.",
+		[]string{"drive", "state"}, nil,
+	)
+	driveRestartsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "drive", "restarts_total"),
+		"Number of automatic restarts of the drive's mount unit.",
+		[]string{"drive"}, nil,
+	)
+	driveErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "drive", "errors_total"),
+		"Errors seen by the journald reader, by error class.",
+		[]string{"drive", "class"}, nil,
+	)
+	driveCacheBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "drive", "cache_bytes"),
+		"Bytes used by the VFS cache of the drive.",
+		[]string{"drive"}, nil,
+	)
+	drivePendingUploadsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "drive", "pending_uploads"),
+		"Files waiting to be uploaded.",
+		[]string{"drive"}, nil,
+	)
+	driveTransferredBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "drive", "transferred_bytes_total"),
+		"Bytes transferred since the drive was mounted.",
+		[]string{"drive"}, nil,
+	)
+	driveSpeedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "drive", "transfer_speed_bytes"),
+		"Current transfer speed in bytes per second.",
+		[]string{"drive"}, nil,
+	)
+)
+
+// driveCollector gathers the drive metrics on every scrape.
+type driveCollector struct {
+	ctx    context.Context
+	gather func(ctx context.Context) ([]driveMetrics, error)
+}
+
+func (c *driveCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- driveMountedDesc
+	ch <- driveStateDesc
+	ch <- driveRestartsDesc
+	ch <- driveErrorsDesc
+	ch <- driveCacheBytesDesc
+	ch <- drivePendingUploadsDesc
+	ch <- driveTransferredBytesDesc
+	ch <- driveSpeedDesc
+}
+
+func (c *driveCollector) Collect(ch chan<- prometheus.Metric) {
+	drives, err := c.gather(c.ctx)
+	if err != nil {
+		log.Printf("Failed to gather metrics: %v", err)
+		ch <- prometheus.NewInvalidMetric(driveMountedDesc, err)
+		return
+	}
+	for _, d := range drives {
+		mounted := 0.0
+		if d.State == "active" {
+			mounted = 1
+		}
+		ch <- prometheus.MustNewConstMetric(driveMountedDesc, prometheus.GaugeValue, mounted, d.Name)
+		ch <- prometheus.MustNewConstMetric(driveStateDesc, prometheus.GaugeValue, 1, d.Name, d.State)
+		ch <- prometheus.MustNewConstMetric(driveRestartsDesc, prometheus.CounterValue, float64(d.Restarts), d.Name)
+		for class, n := range d.Errors {
+			ch <- prometheus.MustNewConstMetric(driveErrorsDesc, prometheus.CounterValue, float64(n), d.Name, class)
+		}
+		if d.State != "active" {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(driveCacheBytesDesc, prometheus.GaugeValue, float64(d.CacheBytes), d.Name)
+		ch <- prometheus.MustNewConstMetric(drivePendingUploadsDesc, prometheus.GaugeValue, float64(d.PendingUploads), d.Name)
+		ch <- prometheus.MustNewConstMetric(driveTransferredBytesDesc, prometheus.CounterValue, float64(d.Bytes), d.Name)
+		ch <- prometheus.MustNewConstMetric(driveSpeedDesc, prometheus.GaugeValue, d.Speed, d.Name)
+	}
+}
+
+// gatherDriveMetrics collects the metrics from systemd, the state written by the journald readers and the mounts.
+func gatherDriveMetrics(ctx context.Context, sm serviceManager) ([]driveMetrics, error) {
+	statuses, err := statusServices(ctx, sm, getRemotes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service status: %w", err)
+	}
+	state, err := loadState()
+	if err != nil {
+		return nil, err
+	}
+
+	drives := make([]driveMetrics, 0, len(statuses))
+	for _, status := range statuses {
+		d := driveMetrics{
+			Name:   unitNameToDriveName(status.Name),
+			State:  status.ActiveState,
+			Errors: state.ErrorCounts[unitNameToDriveName(status.Name)],
+		}
+		if n, err := sm.Restarts(ctx, status.Name); err == nil {
+			d.Restarts = n
+		}
+		if d.State == "active" {
+			if err := gatherMountMetrics(ctx, &d); err != nil {
+				log.Printf("Failed to gather metrics of %q: %v", d.Name, err)
+			}
+		}
+		drives = append(drives, d)
+	}
+	return drives, nil
+}
+
+func gatherMountMetrics(ctx context.Context, d *driveMetrics) error {
+	stats, err := getVFSStats(ctx, d.Name)
+	if err != nil {
+		return err
+	}
+	d.CacheBytes = stats.DiskCache.BytesUsed
+	d.PendingUploads = stats.DiskCache.UploadsInProgress + stats.DiskCache.UploadsQueued
+
+	var coreStats struct {
+		Bytes int64   `json:"bytes"`
+		Speed float64 `json:"speed"`
+	}
+	if err := rcCall(ctx, d.Name, "core/stats", nil, &coreStats); err != nil {
+		return err
+	}
+	d.Bytes = coreStats.Bytes
+	d.Speed = coreStats.Speed
+	return nil
+}
+
+func newMetricsRegistry(ctx context.Context, gather func(ctx context.Context) ([]driveMetrics, error)) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&driveCollector{ctx: ctx, gather: gather})
+	return registry
+}
+
+func serveMetrics(cmd *cobra.Command, _ []string) {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sm, err := newServiceManager(ctx)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer sm.Close()
+
+	registry := newMetricsRegistry(ctx, func(ctx context.Context) ([]driveMetrics, error) {
+		return gatherDriveMetrics(ctx, sm)
+	})
+
+	if metricsCmdFlags.Textfile != "" {
+		go writeMetricsTextfile(ctx, registry, metricsCmdFlags.Textfile, metricsCmdFlags.Interval)
+	}
+	if metricsCmdFlags.Listen == "" {
+		<-ctx.Done()
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	srv := &http.Server{
+		Addr:              metricsCmdFlags.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Printf("Serving metrics on http://%s/metrics", metricsCmdFlags.Listen)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server error: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	ctxShutdown, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	if err := srv.Shutdown(ctxShutdown); err != nil {
+		log.Fatalf("Server shutdown error: %v", err)
+	}
+}
+
+// writeMetricsTextfile writes the metrics for the node_exporter textfile collector in regular intervals.
+func writeMetricsTextfile(ctx context.Context, registry *prometheus.Registry, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// WriteToTextfile writes to a temporary file first, so the collector never reads a partial file
+		if err := prometheus.WriteToTextfile(path, registry); err != nil {
+			log.Printf("Failed to write metrics to %s: %v", path, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
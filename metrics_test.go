@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDriveCollector(t *testing.T) {
+	registry := newMetricsRegistry(context.Background(), func(context.Context) ([]driveMetrics, error) {
+		return []driveMetrics{
+			{
+				Name:           "My_Drive",
+				State:          "active",
+				Restarts:       2,
+				Errors:         map[string]int{"permission": 3},
+				CacheBytes:     1024,
+				PendingUploads: 1,
+				Bytes:          4096,
+				Speed:          512,
+			},
+			{
+				Name:  "Shared",
+				State: "inactive",
+			},
+		}, nil
+	})
+
+	expected := `
+# HELP adfinis_rclone_mgr_drive_mounted Whether the drive is mounted.
+# TYPE adfinis_rclone_mgr_drive_mounted gauge
+adfinis_rclone_mgr_drive_mounted{drive="My_Drive"} 1
+adfinis_rclone_mgr_drive_mounted{drive="Shared"} 0
+# HELP adfinis_rclone_mgr_drive_errors_total Errors seen by the journald reader, by error class.
+# TYPE adfinis_rclone_mgr_drive_errors_total counter
+adfinis_rclone_mgr_drive_errors_total{class="permission",drive="My_Drive"} 3
+# HELP adfinis_rclone_mgr_drive_pending_uploads Files waiting to be uploaded.
+# TYPE adfinis_rclone_mgr_drive_pending_uploads gauge
+adfinis_rclone_mgr_drive_pending_uploads{drive="My_Drive"} 1
+# HELP adfinis_rclone_mgr_drive_restarts_total Number of automatic restarts of the drive's mount unit.
+# TYPE adfinis_rclone_mgr_drive_restarts_total counter
+adfinis_rclone_mgr_drive_restarts_total{drive="My_Drive"} 2
+adfinis_rclone_mgr_drive_restarts_total{drive="Shared"} 0
+`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"adfinis_rclone_mgr_drive_mounted",
+		"adfinis_rclone_mgr_drive_errors_total",
+		"adfinis_rclone_mgr_drive_pending_uploads",
+		"adfinis_rclone_mgr_drive_restarts_total",
+	)
+	assert.NoError(t, err)
+}
+
+func TestDriveCollectorError(t *testing.T) {
+	registry := newMetricsRegistry(context.Background(), func(context.Context) ([]driveMetrics, error) {
+		return nil, errors.New("no session bus")
+	})
+	_, err := registry.Gather()
+	assert.Error(t, err)
+}
@@ -5,4 +5,14 @@ type Drive struct {
 	ID        string `json:"id"`
 	Enabled   bool   `json:"enabled"`
 	AutoMount bool   `json:"auto_mount"`
+	// LocalName replaces Name for the remote and the mountpoint if set
+	LocalName string `json:"local_name,omitempty"`
+	// Remote is the remote the drive is configured as right now, found by its ID in rclone.conf
+	Remote string `json:"remote,omitempty"`
+	// Folder is set if only a folder is mounted, ID is the ID of the folder then
+	Folder bool `json:"folder,omitempty"`
+	// TeamDrive is the shared drive the folder is in, if any
+	TeamDrive string `json:"team_drive,omitempty"`
+	// Profile is the profile whose account the drive belongs to, "" for the default profile
+	Profile string `json:"profile,omitempty"`
 }
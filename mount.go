@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/lipgloss/table"
@@ -22,6 +23,9 @@ func availableMountsForArgs(cmd *cobra.Command, args []string, toComplete string
 	}
 	// remove args from the list of available mounts
 	remotes := getRemotes()
+	if profile, ok := profileFilter(cmd); ok {
+		remotes = profileRemotes(remotes, profile)
+	}
 	wantedRemotes := make([]string, 0, len(remotes))
 	for _, remote := range remotes {
 		if !lo.Contains(args, remote) {
@@ -32,11 +36,12 @@ func availableMountsForArgs(cmd *cobra.Command, args []string, toComplete string
 }
 
 func getMountsWithStatus(ctx context.Context, remotes []string) []string {
-	conn, err := dbus.NewUserConnectionContext(ctx)
+	sm, err := newServiceManager(ctx)
 	if err != nil {
-		log.Fatalln("Failed to start dbus connection:", err)
+		log.Fatalln(err)
 	}
-	statuses, err := statusServices(ctx, conn, remotes)
+	defer sm.Close()
+	statuses, err := statusServices(ctx, sm, remotes)
 	if err != nil {
 		log.Fatalln("Failed to get service status:", err)
 	}
@@ -49,95 +54,230 @@ func getMountsWithStatus(ctx context.Context, remotes []string) []string {
 	return mounts
 }
 
-func mount(cmd *cobra.Command, args []string) {
-	conn, err := dbus.NewUserConnectionContext(cmd.Context())
+// profileFilter returns the profile given with --profile, false if the command isn't limited to one.
+func profileFilter(cmd *cobra.Command) (string, bool) {
+	if !cmd.Flags().Changed("profile") {
+		return "", false
+	}
+	name, _ := cmd.Flags().GetString("profile")
+	profile, err := parseProfile(name)
 	if err != nil {
-		log.Fatalln("Failed to start dbus connection:", err)
+		log.Fatalln(err)
 	}
-	if lo.Contains(args, "all") {
-		args = getRemotes()
+	return profile, true
+}
+
+// mountArgs returns the drives to mount or umount, "all" are all drives, or all drives of the profile with --profile.
+func mountArgs(cmd *cobra.Command, args []string) []string {
+	profile, ok := profileFilter(cmd)
+	if !ok {
+		if lo.Contains(args, "all") {
+			return getRemotes()
+		}
+		return args
+	}
+	resolved, err := profileArgs(args, profile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return resolved
+}
+
+func mount(cmd *cobra.Command, args []string) {
+	sm, err := newServiceManager(cmd.Context())
+	if err != nil {
+		log.Fatalln(err)
 	}
-	for _, arg := range args {
-		if err := ensureFolderExists(getDriveDataPath(arg)); err != nil {
+	defer sm.Close()
+	args = mountArgs(cmd, args)
+	mountDrives(cmd.Context(), sm, args)
+}
+
+// mountDrives starts the mounts of the drives and returns the ones that failed.
+func mountDrives(ctx context.Context, sm serviceManager, names []string) []string {
+	var failed []string
+	for _, name := range names {
+		if err := ensureFolderExists(getDriveDataPath(name)); err != nil {
 			log.Printf("Failed to create mount path: %v", err)
+			failed = append(failed, name)
 			continue
 		}
-		if err := startService(cmd.Context(), conn, arg); err != nil {
+		if err := startService(ctx, sm, name); err != nil {
 			log.Printf("Failed to mount drive: %v", err)
+			failed = append(failed, name)
 			continue
 		}
-		log.Println("Mounted Drive:", arg)
+		log.Println("Mounted Drive:", name)
+		if err := setDriveIdle(name, false); err != nil {
+			log.Println(err)
+		}
 	}
+	return failed
 }
 
 func umount(cmd *cobra.Command, args []string) {
-	conn, err := dbus.NewUserConnectionContext(cmd.Context())
+	sm, err := newServiceManager(cmd.Context())
 	if err != nil {
-		log.Fatalln("Failed to start dbus connection:", err)
+		log.Fatalln(err)
 	}
-	if lo.Contains(args, "all") {
-		args = getRemotes()
-	}
-	for _, arg := range args {
-		if err := stopService(cmd.Context(), conn, arg); err != nil {
+	defer sm.Close()
+	args = mountArgs(cmd, args)
+	umountDrives(cmd.Context(), sm, args, umountCmdFlags.Force)
+}
+
+// umountDrives stops the mounts of the drives and returns the ones that failed.
+func umountDrives(ctx context.Context, sm serviceManager, names []string, force bool) []string {
+	var failed []string
+	for _, name := range names {
+		if err := stopService(ctx, sm, name); err != nil {
 			log.Printf("Failed to umount drive: %v", err)
+			failed = append(failed, name)
 			continue
 		}
-		log.Println("Umounted Drive:", arg)
+		log.Println("Umounted Drive:", name)
+		// unmounted on purpose, opening the folder shouldn't mount it again
+		if err := setDriveIdle(name, false); err != nil {
+			log.Println(err)
+		}
+
+		if force {
+			forceUmount(ctx, name)
+		}
+	}
+	return failed
+}
 
-		if umountCmdFlags.Force {
-			forceUmount(cmd.Context(), arg)
+// fusermountNames are tried in this order, fuse3-only distributions only ship fusermount3.
+// rclone@.service unmounts with the same ones.
+var fusermountNames = []string{"fusermount3", "fusermount"}
+
+// findFusermount returns the path of fusermount3 or fusermount.
+func findFusermount() (string, error) {
+	for _, name := range fusermountNames {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
 		}
 	}
+	return "", fmt.Errorf("neither %s found in PATH", strings.Join(fusermountNames, " nor "))
 }
 
 // forceUmount calls fusermount -u to force unmount the drive in addition to stopping the systemd service.
 // This doesnt always work, but it is a good last resort.
 // Errors are always ignored, as fusermount -u will return an error if the drive is not mounted.
 func forceUmount(ctx context.Context, driveName string) {
+	runFusermount(ctx, driveName, "-u")
+}
+
+// lazyUmount detaches the mount of the drive even while it's busy or hung, like forceUmount errors are ignored.
+func lazyUmount(ctx context.Context, driveName string) {
+	runFusermount(ctx, driveName, "-uz")
+}
+
+func runFusermount(ctx context.Context, driveName, flag string) {
+	fusermount, err := findFusermount()
+	if err != nil {
+		log.Println(err)
+		return
+	}
 	drivePath := getDriveDataPath(driveName)
-	exec.CommandContext(ctx, "/bin/fusermount", "-u", drivePath).Run() //nolint:errcheck
+	exec.CommandContext(ctx, fusermount, flag, drivePath).Run() //nolint:errcheck
 }
 
 func list(cmd *cobra.Command, _ []string) {
-	conn, err := dbus.NewUserConnectionContext(cmd.Context())
+	sm, err := newServiceManager(cmd.Context())
 	if err != nil {
-		log.Fatalln("Failed to start dbus connection:", err)
+		log.Fatalln(err)
 	}
-	statuses, err := statusServices(cmd.Context(), conn, getRemotes())
+	defer sm.Close()
+	remotes := getRemotes()
+	if profile, ok := profileFilter(cmd); ok {
+		remotes = profileRemotes(remotes, profile)
+	}
+	serviceStatuses, err := listServiceStatuses(cmd.Context(), sm, remotes)
 	if err != nil {
-		log.Fatalln("Failed to get service status:", err)
+		log.Fatalln(err)
 	}
 
 	if listCmdFlags.JSON {
-		renderJSON(statuses)
+		renderJSON(serviceStatuses)
 	} else if listCmdFlags.YAML {
-		renderYAML(statuses)
+		renderYAML(serviceStatuses)
 	} else {
-		renderTable(statuses)
+		renderTable(serviceStatuses)
+	}
+}
+
+// listServiceStatuses returns the status of the mounts of the drives, including the bandwidth limit of running ones.
+func listServiceStatuses(ctx context.Context, sm serviceManager, names []string) ([]serviceStatus, error) {
+	statuses, err := statusServices(ctx, sm, names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service status: %w", err)
+	}
+
+	state, err := loadState()
+	if err != nil {
+		return nil, err
+	}
+
+	serviceStatuses := statusesToServiceStatuses(statuses)
+	for i, s := range serviceStatuses {
+		if s.Status != "active" {
+			if lo.Contains(state.Automount.Waiting, s.Name) {
+				serviceStatuses[i].Status = "waiting for network"
+			} else if lo.Contains(state.Idle, s.Name) {
+				serviceStatuses[i].Status = "idle"
+			} else if _, ok := state.Automount.Retrying[s.Name]; ok {
+				serviceStatuses[i].Status = "retrying"
+			}
+			continue
+		}
+		// hung mounts would block the rc call as well
+		if state.Health[s.Name].Unhealthy {
+			serviceStatuses[i].Status = "unhealthy"
+			continue
+		}
+		// mounts stay active while offline, but they won't work as expected
+		if state.Network.Offline {
+			serviceStatuses[i].Status = "offline"
+		}
+		rate, err := getBandwidthLimit(ctx, s.Name)
+		if err != nil {
+			rate = "?"
+		}
+		serviceStatuses[i].Bandwidth = rate
 	}
+	return serviceStatuses, nil
 }
 
-func renderTable(statuses []dbus.UnitStatus) {
+func renderTable(statuses []serviceStatus) {
 	rows := make([][]string, len(statuses))
 	for i, status := range statuses {
 
 		var prefix string
-		switch status.ActiveState {
+		switch status.Status {
 		case "active":
 			prefix = "✅"
 		case "failed":
 			prefix = "☠️"
 		case "inactive":
 			prefix = "⬜"
+		case "offline":
+			prefix = "📴"
+		case "unhealthy":
+			prefix = "⚠️"
+		case "waiting for network", "retrying":
+			prefix = "⏳"
+		case "idle":
+			prefix = "💤"
 		default:
 			prefix = "❓"
 		}
 		rows[i] = []string{
 			prefix,
-			status.Name,
-			status.ActiveState,
-			getDriveDataPath(unitNameToDriveName(status.Name)),
+			driveNameToUnitName(status.Name),
+			status.Status,
+			status.Bandwidth,
+			status.MountPath,
 		}
 	}
 
@@ -157,7 +297,7 @@ func renderTable(statuses []dbus.UnitStatus) {
 				return cellStyle
 			}
 		}).
-		Headers("Ok?", "Name", "Status", "Mount Path").
+		Headers("Ok?", "Name", "Status", "Bandwidth", "Mount Path").
 		Rows(rows...)
 
 	fmt.Println()
@@ -169,6 +309,8 @@ type serviceStatus struct {
 	Name      string
 	Status    string
 	MountPath string
+	// Bandwidth is the current bandwidth limit of a running mount
+	Bandwidth string
 }
 
 func statusesToServiceStatuses(statuses []dbus.UnitStatus) []serviceStatus {
@@ -183,18 +325,16 @@ func statusesToServiceStatuses(statuses []dbus.UnitStatus) []serviceStatus {
 	return serviceStatuses
 }
 
-func renderJSON(statuses []dbus.UnitStatus) {
-	s := statusesToServiceStatuses(statuses)
-	jsonData, err := json.MarshalIndent(s, "", "  ")
+func renderJSON(statuses []serviceStatus) {
+	jsonData, err := json.MarshalIndent(statuses, "", "  ")
 	if err != nil {
 		log.Fatalln("Failed to marshal JSON:", err)
 	}
 	fmt.Println(string(jsonData))
 }
 
-func renderYAML(statuses []dbus.UnitStatus) {
-	s := statusesToServiceStatuses(statuses)
-	yamlData, err := yaml.Marshal(s)
+func renderYAML(statuses []serviceStatus) {
+	yamlData, err := yaml.Marshal(statuses)
 	if err != nil {
 		log.Fatalln("Failed to marshal YAML:", err)
 	}
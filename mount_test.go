@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManageDriveServices(t *testing.T) {
+	useTempDirs(t)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+
+	// a drive that gets disabled loses its cache
+	assert.NoError(t, ensureFolderExists(getDriveCachePath("Old")))
+	assert.NoError(t, sm.StartUnit(ctx, "rclone@Old.service"))
+	assert.NoError(t, sm.EnableUnit(ctx, "rclone@Old.service"))
+
+	// unchecking automount disables the unit again
+	assert.NoError(t, sm.EnableUnit(ctx, "rclone@Manual.service"))
+	err := manageDriveServices(ctx, sm, []models.Drive{
+		{Name: "My Drive", Enabled: true, AutoMount: true},
+		{Name: "Manual", Enabled: true},
+		{Name: "Old"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sm.reloads)
+
+	active, fileState := sm.state("rclone@My_Drive.service")
+	assert.Equal(t, "active", active)
+	assert.Equal(t, "enabled", fileState)
+	assert.DirExists(t, getDriveDataPath("My_Drive"))
+
+	active, fileState = sm.state("rclone@Manual.service")
+	assert.Equal(t, "active", active)
+	assert.Equal(t, "disabled", fileState)
+
+	active, fileState = sm.state("rclone@Old.service")
+	assert.Equal(t, "inactive", active)
+	assert.Equal(t, "disabled", fileState)
+	_, err = os.Stat(getDriveCachePath("Old"))
+	assert.True(t, os.IsNotExist(err))
+
+	active, fileState = sm.state(daemonUnitName)
+	assert.Equal(t, "active", active)
+	assert.Equal(t, "enabled", fileState)
+}
+
+func TestManageDriveServicesFailedStart(t *testing.T) {
+	useTempDirs(t)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	sm.setJobResult("start", "rclone@Broken.service", "failed")
+
+	err := manageDriveServices(ctx, sm, []models.Drive{
+		{Name: "Broken", Enabled: true, AutoMount: true},
+		{Name: "Works", Enabled: true, AutoMount: true},
+	})
+	assert.ErrorContains(t, err, `failed to start service "rclone@Broken.service": failed`)
+
+	// a drive that fails to mount isn't enabled, the others are handled anyway
+	active, fileState := sm.state("rclone@Broken.service")
+	assert.Equal(t, "failed", active)
+	assert.Equal(t, "disabled", fileState)
+	active, _ = sm.state("rclone@Works.service")
+	assert.Equal(t, "active", active)
+}
+
+func TestMountLifecycle(t *testing.T) {
+	useTempDirs(t)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	sm.setJobResult("start", "rclone@Slow.service", "timeout")
+	sm.setJobResult("stop", "rclone@Stuck.service", "failed")
+
+	failed := mountDrives(ctx, sm, []string{"My_Drive", "Slow", "Stuck"})
+	assert.Equal(t, []string{"Slow"}, failed)
+
+	statuses, err := listServiceStatuses(ctx, sm, []string{"My_Drive", "Slow", "Stuck", "Other"})
+	assert.NoError(t, err)
+	assert.Equal(t, []serviceStatus{
+		// there is no rclone running, so the bandwidth limit is unknown
+		{Name: "My_Drive", Status: "active", MountPath: getDriveDataPath("My_Drive"), Bandwidth: "?"},
+		{Name: "Slow", Status: "failed", MountPath: getDriveDataPath("Slow")},
+		{Name: "Stuck", Status: "active", MountPath: getDriveDataPath("Stuck"), Bandwidth: "?"},
+		{Name: "Other", Status: "inactive", MountPath: getDriveDataPath("Other")},
+	}, statuses)
+
+	failed = umountDrives(ctx, sm, []string{"My_Drive", "Stuck"}, false)
+	assert.Equal(t, []string{"Stuck"}, failed)
+	active, _ := sm.state("rclone@My_Drive.service")
+	assert.Equal(t, "inactive", active)
+	active, _ = sm.state("rclone@Stuck.service")
+	assert.Equal(t, "active", active)
+}
+
+func TestListServiceStatusesOffline(t *testing.T) {
+	useTempDirs(t)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	assert.NoError(t, setNetworkState(networkStatus{Online: false}))
+	assert.NoError(t, sm.StartUnit(ctx, "rclone@My_Drive.service"))
+
+	statuses, err := listServiceStatuses(ctx, sm, []string{"My_Drive"})
+	assert.NoError(t, err)
+	assert.Equal(t, "offline", statuses[0].Status)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	godbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	nmDest      = "org.freedesktop.NetworkManager"
+	nmPath      = "/org/freedesktop/NetworkManager"
+	nmInterface = "org.freedesktop.NetworkManager"
+)
+
+// see NMConnectivityState in the NetworkManager docs
+const (
+	nmConnectivityUnknown = 0
+	nmConnectivityNone    = 1
+	nmConnectivityPortal  = 2
+	nmConnectivityLimited = 3
+	nmConnectivityFull    = 4
+)
+
+// see NMMetered in the NetworkManager docs
+const (
+	nmMeteredUnknown  = 0
+	nmMeteredYes      = 1
+	nmMeteredNo       = 2
+	nmMeteredGuessYes = 3
+	nmMeteredGuessNo  = 4
+)
+
+type networkStatus struct {
+	Online  bool
+	Metered bool
+}
+
+// networkStatusFromNM maps the NetworkManager properties to what we care about.
+// Unknown connectivity happens if connectivity checking is disabled, in that case we rather assume we are online.
+// A captive portal or limited connectivity doesn't reach Google either, so they count as offline.
+func networkStatusFromNM(connectivity, metered uint32) networkStatus {
+	var status networkStatus
+	switch connectivity {
+	case nmConnectivityFull, nmConnectivityUnknown:
+		status.Online = true
+	case nmConnectivityNone, nmConnectivityPortal, nmConnectivityLimited:
+		status.Online = false
+	}
+	switch metered {
+	case nmMeteredYes, nmMeteredGuessYes:
+		status.Metered = true
+	case nmMeteredNo, nmMeteredGuessNo, nmMeteredUnknown:
+		status.Metered = false
+	}
+	return status
+}
+
+func readNetworkStatus(obj godbus.BusObject) (networkStatus, error) {
+	connectivity, err := obj.GetProperty(nmInterface + ".Connectivity")
+	if err != nil {
+		return networkStatus{}, fmt.Errorf("failed to get connectivity: %w", err)
+	}
+	metered, err := obj.GetProperty(nmInterface + ".Metered")
+	if err != nil {
+		return networkStatus{}, fmt.Errorf("failed to get metered state: %w", err)
+	}
+	c, _ := connectivity.Value().(uint32)
+	m, _ := metered.Value().(uint32)
+	return networkStatusFromNM(c, m), nil
+}
+
+// watchNetworkManager sends the current network status and every change of it to updates.
+// It returns once ctx is done or the connection to the system bus is lost.
+func watchNetworkManager(ctx context.Context, updates chan<- networkStatus) error {
+	conn, err := godbus.ConnectSystemBus(godbus.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to connect to system bus: %w", err)
+	}
+	defer conn.Close() // nolint:errcheck
+
+	err = conn.AddMatchSignalContext(ctx,
+		godbus.WithMatchObjectPath(nmPath),
+		godbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		godbus.WithMatchMember("PropertiesChanged"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to NetworkManager: %w", err)
+	}
+	signals := make(chan *godbus.Signal, 10)
+	conn.Signal(signals)
+
+	obj := conn.Object(nmDest, nmPath)
+	last, err := readNetworkStatus(obj)
+	if err != nil {
+		return err
+	}
+	updates <- last
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-signals:
+			if !ok {
+				return fmt.Errorf("lost connection to system bus")
+			}
+			// simply re-read the properties, that's easier than merging the changed ones
+			current, err := readNetworkStatus(obj)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if current != last {
+				last = current
+				updates <- current
+			}
+		}
+	}
+}
+
+func setNetworkState(status networkStatus) error {
+	return updateState(func(s *managerState) error {
+		s.Network = networkState{
+			Offline: !status.Online,
+			Metered: status.Metered,
+			Since:   time.Now(),
+		}
+		return nil
+	})
+}
+
+// isOffline reports whether the daemon saw the network going offline.
+func isOffline() bool {
+	state, err := loadState()
+	if err != nil {
+		return false
+	}
+	return state.Network.Offline
+}
+
+// refreshDirCaches makes running mounts pick up remote changes missed while offline.
+func refreshDirCaches(ctx context.Context, drives []string) {
+	for _, name := range drives {
+		if err := rcCall(ctx, name, "vfs/refresh", map[string]string{"recursive": "false"}, nil); err != nil {
+			log.Printf("Failed to refresh directory cache of %q: %v", name, err)
+			continue
+		}
+		log.Printf("Refreshed directory cache of %q", name)
+	}
+}
+
+func (d *mgrDaemon) runNetworkWatcher(ctx context.Context) error {
+	updates := make(chan networkStatus)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- watchNetworkManager(ctx, updates)
+	}()
+	// don't leave the drives marked offline when the daemon stops
+	defer setNetworkState(networkStatus{Online: true}) // nolint:errcheck
+
+	wasOnline := true
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case status := <-updates:
+			log.Printf("Network changed: online=%t metered=%t", status.Online, status.Metered)
+			if err := setNetworkState(status); err != nil {
+				log.Printf("Failed to save network state: %v", err)
+			}
+			if status.Online && !wasOnline {
+				drives, err := activeDrives(ctx, d.sm)
+				if err != nil {
+					log.Println(err)
+				} else {
+					refreshDirCaches(ctx, drives)
+				}
+			}
+			wasOnline = status.Online
+			// uploads might need to be paused or resumed
+			if err := applyBandwidthLimits(ctx, d.sm); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetworkStatusFromNM(t *testing.T) {
+	for _, test := range []struct {
+		connectivity uint32
+		metered      uint32
+		expected     networkStatus
+	}{
+		{nmConnectivityFull, nmMeteredNo, networkStatus{Online: true}},
+		{nmConnectivityFull, nmMeteredYes, networkStatus{Online: true, Metered: true}},
+		{nmConnectivityFull, nmMeteredGuessYes, networkStatus{Online: true, Metered: true}},
+		{nmConnectivityFull, nmMeteredGuessNo, networkStatus{Online: true}},
+		{nmConnectivityUnknown, nmMeteredUnknown, networkStatus{Online: true}},
+		{nmConnectivityNone, nmMeteredUnknown, networkStatus{}},
+		{nmConnectivityPortal, nmMeteredNo, networkStatus{}},
+		{nmConnectivityLimited, nmMeteredYes, networkStatus{Metered: true}},
+	} {
+		assert.Equal(t, test.expected, networkStatusFromNM(test.connectivity, test.metered))
+	}
+}
+
+func TestEffectiveBandwidthLimitMetered(t *testing.T) {
+	now := time.Date(2025, 6, 2, 9, 0, 0, 0, time.Local)
+	metered := &managerState{Network: networkState{Metered: true}}
+
+	cfg := &managerConfig{Network: networkConfig{PauseUploadsOnMetered: true}}
+	limit, err := effectiveBandwidthLimit(cfg, metered, "My_Drive", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "1Ki:off", limit)
+
+	// downloads keep their limit
+	metered.BandwidthOverrides = map[string]bandwidthOverride{"all": {Rate: "1M"}}
+	limit, err = effectiveBandwidthLimit(cfg, metered, "My_Drive", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "1Ki:1Mi", limit)
+
+	// not configured to pause
+	limit, err = effectiveBandwidthLimit(&managerConfig{}, metered, "My_Drive", now)
+	assert.NoError(t, err)
+	assert.Equal(t, "1Mi", limit)
+}
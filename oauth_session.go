@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"golang.org/x/oauth2"
+)
+
+const (
+	sessionCookieName = "session"
+	sessionLifetime   = time.Hour
+)
+
+// authSession is everything a single login in the web UI needs to remember.
+// It never leaves the process, the browser only gets the random session ID.
+type authSession struct {
+	id      string
+	created time.Time
+	// csrf has to be sent along with every form
+	csrf string
+
+	clientID     string
+	clientSecret string
+	// state and verifier are set when the login at Google starts
+	state    string
+	verifier string
+	token    *oauth2.Token
+	// drives and orphans are what the selection page showed, with the current state
+	drives  []models.Drive
+	orphans []string
+}
+
+func (s *authSession) validCSRF(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(s.csrf), []byte(token)) == 1
+}
+
+// sessionStore keeps the sessions of the web UI in memory.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*authSession
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: map[string]*authSession{}}
+}
+
+// create starts a new session and sets its cookie.
+func (s *sessionStore) create(w http.ResponseWriter) *authSession {
+	session := &authSession{
+		id:      rand.Text(),
+		created: time.Now(),
+		csrf:    rand.Text(),
+	}
+	s.mu.Lock()
+	s.expire()
+	s.sessions[session.id] = session
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    session.id,
+		Path:     "/",
+		MaxAge:   int(sessionLifetime.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return session
+}
+
+// startLogin gives the session a new state and PKCE verifier for the login at Google.
+func (s *sessionStore) startLogin(session *authSession, clientID, clientSecret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session.clientID = clientID
+	session.clientSecret = clientSecret
+	session.state = rand.Text()
+	session.verifier = oauth2.GenerateVerifier()
+	session.token = nil
+}
+
+// expire drops old sessions, the caller has to hold the lock.
+func (s *sessionStore) expire() {
+	for id, session := range s.sessions {
+		if time.Since(session.created) > sessionLifetime {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// get returns the session of the request's cookie.
+func (s *sessionStore) get(r *http.Request) (*authSession, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	session, ok := s.sessions[cookie.Value]
+	return session, ok
+}
+
+// byState returns the session that started the login with state.
+// The redirect back from Google is a cross-site request, so the SameSite=Strict cookie isn't sent along.
+// The state is only valid once.
+func (s *sessionStore) byState(state string) (*authSession, bool) {
+	if state == "" {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	for _, session := range s.sessions {
+		if session.state != "" && subtle.ConstantTimeCompare([]byte(session.state), []byte(state)) == 1 {
+			session.state = ""
+			return session, true
+		}
+	}
+	return nil, false
+}
+
+// remove ends a session, e.g. after the config was generated.
+func (s *sessionStore) remove(session *authSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, session.id)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/spf13/cobra"
+)
+
+// defaultProfile is the name of the profile without a name, it's what everything used before there were profiles.
+const defaultProfile = "default"
+
+// profileNamePattern matches names that work as remote prefix, directory and keyring service.
+// systemd turns '-' in the instance name into '/', so it's left out.
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_]*$`)
+
+// activeProfile is the profile the command works with, "" is the default profile.
+// It scopes the keyring entries and the remotes gdrive-config manages.
+var activeProfile string
+
+// parseProfile checks a profile name given on the command line, "default" is the default profile.
+func parseProfile(name string) (string, error) {
+	if name == "" || name == defaultProfile {
+		return "", nil
+	}
+	if len(name) > maxLocalNameLength {
+		return "", fmt.Errorf("profile %q is longer than %d characters", name, maxLocalNameLength)
+	}
+	if !profileNamePattern.MatchString(name) {
+		return "", fmt.Errorf("profile %q may only contain letters, digits and '_' and has to start with a letter or digit", name)
+	}
+	return name, nil
+}
+
+// useProfile makes the profile the active one, the command fails on an invalid name.
+func useProfile(name string) {
+	profile, err := parseProfile(name)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	activeProfile = profile
+}
+
+// profileDisplayName is how the profile is shown to the user.
+func profileDisplayName(profile string) string {
+	if profile == "" {
+		return defaultProfile
+	}
+	return profile
+}
+
+// profilePrefix is put in front of the remote names of the profile, so the same drive names don't collide.
+func profilePrefix(profile string) string {
+	if profile == "" {
+		return ""
+	}
+	return profile + "_"
+}
+
+// profileKeyringService keeps the client and token of each profile apart.
+func profileKeyringService(profile string) string {
+	if profile == "" {
+		return keyringService
+	}
+	return keyringService + "/" + profile
+}
+
+// profileMountPath is where a remote of the profile is mounted, drives of a profile get their own directory.
+func profileMountPath(profile, remote string) string {
+	if profile == "" {
+		return path.Join(xdg.Home, "google", remote)
+	}
+	return path.Join(xdg.Home, "google", profile, strings.TrimPrefix(remote, profilePrefix(profile)))
+}
+
+// getMountEnvPath is the environment file rclone@.service reads the mountpoint of a remote from.
+// Needs to match the EnvironmentFile in rclone@.service.
+func getMountEnvPath(name string) string {
+	return path.Join(xdg.ConfigHome, "adfinis-rclone-mgr", "mounts", name+".env")
+}
+
+// readMountEnv returns the variables of the environment file of a remote, nil if it has none.
+func readMountEnv(name string) map[string]string {
+	f, err := os.Open(getMountEnvPath(name))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	env := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			env[key] = strings.Trim(value, `"`)
+		}
+	}
+	return env
+}
+
+// writeMountEnv records the profile of a remote and where it's mounted.
+// Remotes of the default profile don't need one, the unit mounts them at ~/google/<remote>.
+func writeMountEnv(name, profile string) error {
+	if profile == "" {
+		return removeMountEnv(name)
+	}
+	envPath := getMountEnvPath(name)
+	if err := ensureFolderExists(path.Dir(envPath)); err != nil {
+		return err
+	}
+	content := fmt.Sprintf("# written by adfinis-rclone-mgr, read by rclone@.service\nPROFILE=%s\nMOUNT_DIR=%s\n", profile, profileMountPath(profile, name))
+	if err := os.WriteFile(envPath, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", envPath, err)
+	}
+	return nil
+}
+
+func removeMountEnv(name string) error {
+	envPath := getMountEnvPath(name)
+	if err := os.Remove(envPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", envPath, err)
+	}
+	return nil
+}
+
+// remoteProfile returns the profile a remote belongs to, "" for the default profile.
+func remoteProfile(name string) string {
+	return readMountEnv(name)["PROFILE"]
+}
+
+// profileRemotes returns the remotes that belong to the profile.
+func profileRemotes(remotes []string, profile string) []string {
+	var filtered []string
+	for _, name := range remotes {
+		if remoteProfile(name) == profile {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
+
+// profileArgs resolves the drives given on the command line within the profile.
+// "all" are all drives of the profile, a drive can be given with or without the prefix of the profile.
+func profileArgs(args []string, profile string) ([]string, error) {
+	remotes := profileRemotes(getRemotes(), profile)
+	if slices.Contains(args, "all") {
+		return remotes, nil
+	}
+	resolved := make([]string, 0, len(args))
+	for _, name := range args {
+		switch {
+		case slices.Contains(remotes, name):
+			resolved = append(resolved, name)
+		case slices.Contains(remotes, profilePrefix(profile)+name):
+			resolved = append(resolved, profilePrefix(profile)+name)
+		default:
+			return nil, fmt.Errorf("%q isn't a drive of profile %s", name, profileDisplayName(profile))
+		}
+	}
+	return resolved, nil
+}
+
+// knownProfiles returns the profiles gdrive-config was run with, the default profile first.
+func knownProfiles() []string {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Println(err)
+		return []string{""}
+	}
+	return append([]string{""}, cfg.Profiles...)
+}
+
+// rememberProfile adds the profile to the config, so 'discover' looks at its drives as well.
+func rememberProfile(profile string) error {
+	if profile == "" {
+		return nil
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if slices.Contains(cfg.Profiles, profile) {
+		return nil
+	}
+	if slices.Contains(getRemotes(), profile) {
+		return fmt.Errorf("profile %s has the name of a remote, its drives would be mounted inside %s", profile, getDriveDataPath(profile))
+	}
+	cfg.Profiles = append(cfg.Profiles, profile)
+	return cfg.save()
+}
+
+// takenNames are the names new remotes of the active profile can't use.
+// In the default profile that includes the profiles, their directories are next to the mountpoints.
+func takenNames() []string {
+	remotes := getRemotes()
+	if activeProfile != "" {
+		return remotes
+	}
+	return append(remotes, knownProfiles()[1:]...)
+}
+
+// profileFlag is the --profile flag to repeat a command for the profile, empty for the default profile.
+func profileFlag(profile string) string {
+	if profile == "" {
+		return ""
+	}
+	return " --profile " + profile
+}
+
+// addProfileFlag adds --profile to a command, it completes the known profiles.
+func addProfileFlag(cmd *cobra.Command, target *string, usage string) {
+	cmd.Flags().StringVar(target, "profile", "", usage)
+	err := cmd.RegisterFlagCompletionFunc("profile", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		profiles := knownProfiles()
+		names := make([]string, len(profiles))
+		for i, profile := range profiles {
+			names[i] = profileDisplayName(profile)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"path"
+	"testing"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"github.com/adrg/xdg"
+	"github.com/stretchr/testify/assert"
+	"github.com/zalando/go-keyring"
+)
+
+// useActiveProfile switches to the profile for the test.
+func useActiveProfile(t *testing.T, profile string) {
+	t.Helper()
+	previous := activeProfile
+	t.Cleanup(func() { activeProfile = previous })
+	activeProfile = profile
+}
+
+func TestParseProfile(t *testing.T) {
+	for input, want := range map[string]string{
+		"":         "",
+		"default":  "",
+		"acme":     "acme",
+		"Acme_Ltd": "Acme_Ltd",
+	} {
+		profile, err := parseProfile(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, profile, input)
+	}
+	for _, input := range []string{"acme-ltd", "_acme", "acme/x", "a b"} {
+		_, err := parseProfile(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestProfileMountName(t *testing.T) {
+	// the drive knows its profile, whatever profile is active
+	useActiveProfile(t, "other")
+
+	assert.Equal(t, "acme_My_Drive", driveMountName(models.Drive{Name: "My Drive", ID: "my_drive", Profile: "acme"}))
+	assert.Equal(t, "acme_Phoenix", driveMountName(models.Drive{Name: "Project Phoenix", ID: "0AAA", LocalName: "Phoenix", Profile: "acme"}))
+	assert.Equal(t, "My_Drive", driveMountName(models.Drive{Name: "My Drive", ID: "my_drive"}))
+	assert.Equal(t, xdg.Home+"/google/acme/My_Drive", profileMountPath("acme", "acme_My_Drive"))
+}
+
+func TestMountEnv(t *testing.T) {
+	useTempDirs(t)
+
+	assert.Equal(t, xdg.Home+"/google/My_Drive", getDriveDataPath("My_Drive"))
+	assert.Equal(t, "", remoteProfile("My_Drive"))
+
+	assert.NoError(t, writeMountEnv("acme_My_Drive", "acme"))
+	assert.Equal(t, xdg.Home+"/google/acme/My_Drive", getDriveDataPath("acme_My_Drive"))
+	assert.Equal(t, "acme", remoteProfile("acme_My_Drive"))
+	// the unit mounts it there as well
+	assert.Equal(t, xdg.Home+"/google/acme/My_Drive", expandSpecifiers("${MOUNT_DIR}", "acme_My_Drive"))
+	assert.Equal(t, path.Join(xdg.ConfigHome, "adfinis-rclone-mgr", "mounts", "acme_My_Drive.env"), getMountEnvPath("acme_My_Drive"))
+
+	assert.NoError(t, removeMountEnv("acme_My_Drive"))
+	assert.NoFileExists(t, getMountEnvPath("acme_My_Drive"))
+	assert.NoError(t, removeMountEnv("acme_My_Drive"))
+	assert.Equal(t, xdg.Home+"/google/acme_My_Drive", getDriveDataPath("acme_My_Drive"))
+}
+
+const testProfileConfig = `
+[My_Drive]
+type = drive
+client_id = ours
+client_secret = ours-secret
+
+[acme_My_Drive]
+type = drive
+client_id = ours
+client_secret = acme-secret
+
+[acme_Phoenix]
+type = drive
+team_drive = 0AAA
+client_id = ours
+`
+
+func TestProfileRemotes(t *testing.T) {
+	useTempDirs(t)
+	useTempRcloneConfig(t, testProfileConfig)
+	assert.NoError(t, writeMountEnv("acme_My_Drive", "acme"))
+	assert.NoError(t, writeMountEnv("acme_Phoenix", "acme"))
+
+	assert.Equal(t, []string{"My_Drive"}, driveRemotes("ours", ""))
+	_, secret := remoteCredentials("")
+	assert.Equal(t, "ours-secret", secret)
+
+	// both profiles use the same client, the remotes of the default profile aren't orphans of acme
+	assert.Equal(t, []string{"acme_My_Drive", "acme_Phoenix"}, driveRemotes("ours", "acme"))
+	_, secret = remoteCredentials("acme")
+	assert.Equal(t, "acme-secret", secret)
+}
+
+func TestProfileArgs(t *testing.T) {
+	useTempDirs(t)
+	useTempRcloneConfig(t, testProfileConfig)
+	assert.NoError(t, writeMountEnv("acme_My_Drive", "acme"))
+	assert.NoError(t, writeMountEnv("acme_Phoenix", "acme"))
+
+	names, err := profileArgs([]string{"all"}, "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme_My_Drive", "acme_Phoenix"}, names)
+	names, err = profileArgs([]string{"all"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"My_Drive"}, names)
+
+	// with or without the prefix
+	names, err = profileArgs([]string{"My_Drive", "acme_Phoenix"}, "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme_My_Drive", "acme_Phoenix"}, names)
+	_, err = profileArgs([]string{"acme_Phoenix"}, "")
+	assert.ErrorContains(t, err, "isn't a drive of profile default")
+}
+
+func TestProfileKeyring(t *testing.T) {
+	keyring.MockInit()
+
+	assert.NoError(t, setCredentials("ours", "default-secret"))
+	assert.NoError(t, setToken(`{"access_token":"default"}`))
+	useActiveProfile(t, "acme")
+	_, err := getToken()
+	assert.ErrorIs(t, err, keyring.ErrNotFound)
+	assert.NoError(t, setCredentials("ours", "acme-secret"))
+
+	_, secret, err := getCredentials()
+	assert.NoError(t, err)
+	assert.Equal(t, "acme-secret", secret)
+	activeProfile = ""
+	_, secret, err = getCredentials()
+	assert.NoError(t, err)
+	assert.Equal(t, "default-secret", secret)
+}
+
+func TestProfileLocalNames(t *testing.T) {
+	useTempDirs(t)
+
+	assert.NoError(t, saveLocalNames([]models.Drive{{Name: "My Drive", ID: "my_drive", LocalName: "Mine"}}))
+	useActiveProfile(t, "acme")
+	assert.Empty(t, loadLocalNames())
+	assert.NoError(t, saveLocalNames([]models.Drive{{Name: "My Drive", ID: "my_drive", LocalName: "Work"}}))
+	assert.Equal(t, map[string]string{"my_drive": "Work"}, loadLocalNames())
+
+	activeProfile = ""
+	assert.Equal(t, map[string]string{"my_drive": "Mine"}, loadLocalNames())
+}
+
+func TestRememberProfile(t *testing.T) {
+	useTempDirs(t)
+	useTempRcloneConfig(t, testProfileConfig+`
+[customer]
+type = drive
+client_id = ours
+`)
+
+	assert.NoError(t, rememberProfile(""))
+	assert.NoError(t, rememberProfile("acme"))
+	assert.NoError(t, rememberProfile("acme"))
+	assert.Equal(t, []string{"", "acme"}, knownProfiles())
+	// its drives would end up inside the mount of the remote
+	assert.ErrorContains(t, rememberProfile("customer"), "has the name of a remote")
+	assert.Contains(t, takenNames(), "acme")
+
+	useActiveProfile(t, "acme")
+	assert.NotContains(t, takenNames(), "acme")
+}
+
+func TestProfileDiscovery(t *testing.T) {
+	useTempDirs(t)
+
+	assert.NoError(t, rememberDrives([]models.Drive{{Name: "Team", ID: "0AAA"}}))
+	useActiveProfile(t, "acme")
+	assert.NoError(t, rememberDrives([]models.Drive{{Name: "Customer", ID: "0CCC"}}))
+
+	state, err := loadState()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0AAA"}, state.discovery("").KnownDrives)
+	assert.Equal(t, []string{"0CCC"}, state.discovery("acme").KnownDrives)
+}
+
+func TestRenameProfileDrive(t *testing.T) {
+	useTempDirs(t)
+	useTempRcloneConfig(t, testProfileConfig)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	assert.NoError(t, writeMountEnv("acme_Phoenix", "acme"))
+	assert.NoError(t, ensureFolderExists(getDriveDataPath("acme_Phoenix")))
+
+	assert.NoError(t, renameDrive(ctx, sm, "acme_Phoenix", "acme_Ashes"))
+	// still in the directory of the profile
+	assert.Equal(t, "acme", remoteProfile("acme_Ashes"))
+	assert.DirExists(t, xdg.Home+"/google/acme/Ashes")
+	assert.NoDirExists(t, xdg.Home+"/google/acme/Phoenix")
+	assert.NoFileExists(t, getMountEnvPath("acme_Phoenix"))
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v3"
+)
+
+// provisionFile lists the drives 'gdrive-config --from' should set up.
+// Drives that aren't listed are left alone.
+type provisionFile struct {
+	// ClientID and ClientSecret default to the ones in the keyring
+	ClientID     string           `yaml:"client_id,omitempty"`
+	ClientSecret string           `yaml:"client_secret,omitempty"`
+	Drives       []provisionDrive `yaml:"drives"`
+}
+
+type provisionDrive struct {
+	// ID of the shared drive, or "my_drive" and "shared_with_me"
+	ID string `yaml:"id,omitempty"`
+	// Name of the drive in Google Drive, used if there is no ID
+	Name string `yaml:"name,omitempty"`
+	// MountName replaces the name of the drive for the remote and the mountpoint
+	MountName string `yaml:"mount_name,omitempty"`
+	// Enabled defaults to true, false removes the drive
+	Enabled   *bool `yaml:"enabled,omitempty"`
+	AutoMount bool  `yaml:"automount,omitempty"`
+}
+
+func readProvisionFile(filePath string) (*provisionFile, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	pf := &provisionFile{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	// a typo shouldn't silently remove a drive
+	dec.KnownFields(true)
+	if err := dec.Decode(pf); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse %s: %w", filePath, err)
+	}
+	for i, d := range pf.Drives {
+		if d.ID == "" && d.Name == "" {
+			return nil, fmt.Errorf("drive %d in %s has neither id nor name", i+1, filePath)
+		}
+	}
+	return pf, nil
+}
+
+// resolveProvisionDrives matches the drives of the file to the available ones.
+// Drives without a mount_name keep the local name chosen before.
+func resolveProvisionDrives(wanted []provisionDrive, available []models.Drive, localNames map[string]string) ([]models.Drive, error) {
+	var drives []models.Drive
+	var errs []error
+	for _, w := range wanted {
+		var matches []models.Drive
+		for _, d := range available {
+			if (w.ID != "" && d.ID == w.ID) || (w.ID == "" && d.Name == w.Name) {
+				matches = append(matches, d)
+			}
+		}
+		ref := w.ID
+		if ref == "" {
+			ref = w.Name
+		}
+		switch len(matches) {
+		case 0:
+			errs = append(errs, fmt.Errorf("drive %q not found or not accessible", ref))
+			continue
+		case 1:
+		default:
+			errs = append(errs, fmt.Errorf("there are %d drives called %q, use the id instead", len(matches), ref))
+			continue
+		}
+		d := matches[0]
+		d.LocalName = w.MountName
+		if d.LocalName == "" {
+			d.LocalName = localNames[d.ID]
+		}
+		d.Enabled = w.Enabled == nil || *w.Enabled
+		d.AutoMount = d.Enabled && w.AutoMount
+		drives = append(drives, d)
+	}
+
+	if err := validateMountNames(drives, nil); err != nil {
+		errs = append(errs, err)
+	}
+	return drives, joinErrors("Invalid drives", errs)
+}
+
+// driveStatus is how a drive is set up right now.
+type driveStatus struct {
+	Remote    bool
+	AutoMount bool
+	Mounted   bool
+}
+
+// provisionPlan lists what has to be done to get to the wanted drives.
+type provisionPlan struct {
+	// Renames have to be renamed first, Remotes and Services already use the new names
+	Renames []models.Drive
+	// Remotes have to be added or removed
+	Remotes []models.Drive
+	// Services have to be started, stopped, enabled or disabled
+	Services []models.Drive
+	Changes  []string
+}
+
+func planProvision(drives []models.Drive, current map[string]driveStatus) provisionPlan {
+	var plan provisionPlan
+	for _, d := range drives {
+		name := driveMountName(d)
+		cur := current[driveRemoteName(d)]
+		var changes []string
+		remote := false
+		if d.Enabled {
+			if cur.Remote && needsRename(d) {
+				changes = append(changes, fmt.Sprintf("rename %s to %s", d.Remote, name))
+				plan.Renames = append(plan.Renames, d)
+				d.Remote = name
+			}
+			if !cur.Remote {
+				changes = append(changes, fmt.Sprintf("add remote %s", name))
+				remote = true
+			}
+			if !cur.Mounted {
+				changes = append(changes, fmt.Sprintf("mount %s", name))
+			}
+			if d.AutoMount && !cur.AutoMount {
+				changes = append(changes, fmt.Sprintf("mount %s at login", name))
+			} else if !d.AutoMount && cur.AutoMount {
+				changes = append(changes, fmt.Sprintf("don't mount %s at login", name))
+			}
+		} else {
+			name = driveRemoteName(d)
+			if cur.Mounted {
+				changes = append(changes, fmt.Sprintf("unmount %s", name))
+			}
+			if cur.AutoMount {
+				changes = append(changes, fmt.Sprintf("don't mount %s at login", name))
+			}
+			if cur.Remote {
+				changes = append(changes, fmt.Sprintf("remove remote %s", name))
+				remote = true
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		if remote {
+			plan.Remotes = append(plan.Remotes, d)
+		}
+		plan.Services = append(plan.Services, d)
+		plan.Changes = append(plan.Changes, changes...)
+	}
+	return plan
+}
+
+// currentDriveStatus looks up how the configured drives are set up right now, by the name of their remote.
+func currentDriveStatus(ctx context.Context, sm serviceManager, drives []models.Drive) (map[string]driveStatus, error) {
+	active, err := activeDrives(ctx, sm)
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]driveStatus{}
+	for _, d := range drives {
+		if d.Remote == "" {
+			continue
+		}
+		enabled, err := isServiceEnabled(ctx, sm, d.Remote)
+		if err != nil {
+			return nil, err
+		}
+		current[d.Remote] = driveStatus{
+			Remote:    true,
+			AutoMount: enabled,
+			Mounted:   slices.Contains(active, d.Remote),
+		}
+	}
+	return current, nil
+}
+
+// existingToken returns a working token from the keyring or rclone.conf, refreshed if it expired.
+func existingToken(ctx context.Context, oauthConfig *oauth2.Config) (*oauth2.Token, error) {
+	var errs []error
+	saved, err := getToken()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("keyring: %w", err))
+	}
+	for _, raw := range []string{saved, remoteToken(oauthConfig.ClientID, activeProfile)} {
+		if raw == "" {
+			continue
+		}
+		token := &oauth2.Token{}
+		if err := json.Unmarshal([]byte(raw), token); err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse token: %w", err))
+			continue
+		}
+		fresh, err := oauthConfig.TokenSource(ctx, token).Token()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return fresh, nil
+	}
+	return nil, fmt.Errorf("no valid token found, log in once with 'adfinis-rclone-mgr gdrive-config': %w", errors.Join(errs...))
+}
+
+// provisionCredentials returns the client of the file, the keyring or rclone.conf, in that order.
+func provisionCredentials(pf *provisionFile) (string, string, error) {
+	if pf.ClientID != "" && pf.ClientSecret != "" {
+		return pf.ClientID, pf.ClientSecret, nil
+	}
+	clientID, clientSecret := savedCredentials()
+	if clientID == "" {
+		return "", "", errors.New("no client_id and client_secret found, add them to the file or run 'adfinis-rclone-mgr gdrive-config' once")
+	}
+	return clientID, clientSecret, nil
+}
+
+// savedCredentials returns the client of the keyring or rclone.conf, empty if there is none.
+func savedCredentials() (string, string) {
+	clientID, clientSecret, err := getCredentials()
+	if err == nil && clientID != "" && clientSecret != "" {
+		return clientID, clientSecret
+	}
+	return remoteCredentials(activeProfile)
+}
+
+// provision sets up the drives of the file without any interaction.
+// Only the drives that differ from the file are touched, so running it twice changes nothing.
+func provision(ctx context.Context, pf *provisionFile, dryRun bool, out io.Writer) error {
+	clientID, clientSecret, err := provisionCredentials(pf)
+	if err != nil {
+		return err
+	}
+	oauthConfig := newOAuthConfig(clientID, clientSecret)
+	token, err := existingToken(ctx, oauthConfig)
+	if err != nil {
+		return err
+	}
+	available, err := checkAvailableDrives(ctx, oauthConfig, token, activeProfile)
+	if err != nil {
+		return fmt.Errorf("failed to check available drives: %w", err)
+	}
+	drives, err := resolveProvisionDrives(pf.Drives, available, loadLocalNames())
+	if err != nil {
+		return err
+	}
+	drives = withRemotes(drives, driveRemoteIDs(), driveRemotes(clientID, activeProfile))
+	if err := validateMountNames(drives, reservedNames(drives, takenNames(), nil)); err != nil {
+		return err
+	}
+
+	sm, err := newServiceManager(ctx)
+	if err != nil {
+		return err
+	}
+	current, err := currentDriveStatus(ctx, sm, drives)
+	sm.Close()
+	if err != nil {
+		return err
+	}
+
+	plan := planProvision(drives, current)
+	if len(plan.Changes) == 0 {
+		fmt.Fprintln(out, "Nothing to change")
+		return nil
+	}
+	for _, change := range plan.Changes {
+		fmt.Fprintf(out, "- %s\n", change)
+	}
+	if dryRun {
+		return nil
+	}
+
+	tokenString, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to serialize token: %w", err)
+	}
+	if err := saveLocalNames(drives); err != nil {
+		log.Printf("Failed to save local names: %v", err)
+	}
+	if _, err := handleRenames(ctx, plan.Renames); err != nil {
+		return err
+	}
+	if err := handleRcloneConfig(ctx, removalsFirst(plan.Remotes), clientID, clientSecret, string(tokenString)); err != nil {
+		return fmt.Errorf("failed to handle rclone config: %w", err)
+	}
+	if err := setToken(string(tokenString)); err != nil {
+		log.Printf("Failed to save token in keyring: %v", err)
+	}
+	if err := handleSystemdServices(ctx, removalsFirst(plan.Services)); err != nil {
+		return fmt.Errorf("failed to handle systemd services: %w", err)
+	}
+	fmt.Fprintf(out, "Applied %d changes\n", len(plan.Changes))
+	return nil
+}
+
+func gdriveConfigFromFile(cmd *cobra.Command) {
+	pf, err := readProvisionFile(gdriveConfigCmdFlags.From)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := provision(cmd.Context(), pf, gdriveConfigCmdFlags.DryRun, cmd.OutOrStdout()); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeProvisionFile(t *testing.T, content string) string {
+	filePath := filepath.Join(t.TempDir(), "drives.yaml")
+	assert.NoError(t, os.WriteFile(filePath, []byte(content), 0o600))
+	return filePath
+}
+
+func TestReadProvisionFile(t *testing.T) {
+	pf, err := readProvisionFile(writeProvisionFile(t, `
+drives:
+  - id: my_drive
+    automount: true
+  - name: Engineering
+    mount_name: Eng
+  - id: 0ABC
+    enabled: false
+`))
+	assert.NoError(t, err)
+	assert.Len(t, pf.Drives, 3)
+	assert.True(t, pf.Drives[0].AutoMount)
+	assert.Nil(t, pf.Drives[1].Enabled)
+	assert.Equal(t, "Eng", pf.Drives[1].MountName)
+	assert.False(t, *pf.Drives[2].Enabled)
+
+	_, err = readProvisionFile(writeProvisionFile(t, "drives:\n  - id: my_drive\n    automunt: true\n"))
+	assert.ErrorContains(t, err, "automunt")
+
+	_, err = readProvisionFile(writeProvisionFile(t, "drives:\n  - automount: true\n"))
+	assert.ErrorContains(t, err, "neither id nor name")
+}
+
+func TestResolveProvisionDrives(t *testing.T) {
+	available := []models.Drive{
+		{Name: "My Drive", ID: "my_drive"},
+		{Name: "Engineering", ID: "0AAA"},
+		{Name: "Twice", ID: "0BBB"},
+		{Name: "Twice", ID: "0CCC"},
+	}
+	disabled := false
+
+	drives, err := resolveProvisionDrives([]provisionDrive{
+		{ID: "my_drive", AutoMount: true},
+		{Name: "Engineering", MountName: "Eng"},
+		{ID: "0CCC", Enabled: &disabled, AutoMount: true},
+	}, available, map[string]string{"my_drive": "Home"})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Drive{
+		// the stored name is kept
+		{Name: "My Drive", ID: "my_drive", Enabled: true, AutoMount: true, LocalName: "Home"},
+		{Name: "Engineering", ID: "0AAA", Enabled: true, LocalName: "Eng"},
+		{Name: "Twice", ID: "0CCC"},
+	}, drives)
+
+	_, err = resolveProvisionDrives([]provisionDrive{{Name: "Twice"}, {ID: "0DDD"}}, available, nil)
+	assert.ErrorContains(t, err, `there are 2 drives called "Twice"`)
+	assert.ErrorContains(t, err, `drive "0DDD" not found`)
+
+	_, err = resolveProvisionDrives([]provisionDrive{{ID: "0AAA", MountName: "My_Drive"}, {ID: "my_drive"}}, available, nil)
+	assert.ErrorContains(t, err, `would both be mounted as "My_Drive"`)
+
+	_, err = resolveProvisionDrives([]provisionDrive{{ID: "0AAA", MountName: "Project Phoenix"}}, available, nil)
+	assert.ErrorContains(t, err, "may only contain")
+}
+
+func TestPlanProvision(t *testing.T) {
+	drives := []models.Drive{
+		{Name: "My Drive", ID: "my_drive", Enabled: true, AutoMount: true},
+		{Name: "Engineering", ID: "0AAA", Enabled: true, LocalName: "Eng"},
+		{Name: "Old", ID: "0BBB"},
+		{Name: "Gone", ID: "0CCC"},
+	}
+
+	plan := planProvision(drives, map[string]driveStatus{
+		"My_Drive": {Remote: true, Mounted: true},
+		"Eng":      {Remote: true, AutoMount: true},
+		"Old":      {Remote: true, Mounted: true, AutoMount: true},
+	})
+	assert.Equal(t, []string{
+		"mount My_Drive at login",
+		"mount Eng",
+		"don't mount Eng at login",
+		"unmount Old",
+		"don't mount Old at login",
+		"remove remote Old",
+	}, plan.Changes)
+	// only removing Old touches rclone.conf, Gone is neither configured nor mounted
+	assert.Equal(t, []models.Drive{drives[2]}, plan.Remotes)
+	assert.Equal(t, drives[:3], plan.Services)
+
+	plan = planProvision(drives, map[string]driveStatus{})
+	assert.Equal(t, []models.Drive{drives[0], drives[1]}, plan.Remotes)
+	assert.Contains(t, plan.Changes, "add remote Eng")
+
+	// once applied there is nothing left to do
+	plan = planProvision(drives, map[string]driveStatus{
+		"My_Drive": {Remote: true, Mounted: true, AutoMount: true},
+		"Eng":      {Remote: true, Mounted: true},
+	})
+	assert.Empty(t, plan.Changes)
+	assert.Empty(t, plan.Services)
+}
+
+func TestPlanProvisionRename(t *testing.T) {
+	drives := []models.Drive{
+		// renamed in Google Drive
+		{Name: "New Name", ID: "0AAA", Enabled: true, AutoMount: true, Remote: "Old_Name"},
+		{Name: "Gone", ID: "0BBB", LocalName: "G", Remote: "Gone"},
+	}
+	plan := planProvision(drives, map[string]driveStatus{
+		"Old_Name": {Remote: true, Mounted: true, AutoMount: true},
+		"Gone":     {Remote: true},
+	})
+	assert.Equal(t, []string{"rename Old_Name to New_Name", "remove remote Gone"}, plan.Changes)
+	assert.Equal(t, []models.Drive{drives[0]}, plan.Renames)
+	// after the rename the drive only has to be started again
+	renamed := drives[0]
+	renamed.Remote = "New_Name"
+	assert.Equal(t, []models.Drive{renamed, drives[1]}, plan.Services)
+	assert.Equal(t, []models.Drive{drives[1]}, plan.Remotes)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// rcCall calls a method of the rclone remote control API of a running mount.
+// Every mount started by rclone@.service listens on a unix socket in the runtime directory.
+// in and out are marshalled as JSON, out may be nil if the response isn't needed.
+func rcCall(ctx context.Context, driveName, method string, in, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := unixSocketCall(ctx, getDriveRCSocketPath(driveName), method, in, out); err != nil {
+		return fmt.Errorf("rc call %s on %q failed: %w", method, driveName, err)
+	}
+	return nil
+}
+
+// unixSocketCall posts in as JSON to an HTTP server listening on a unix socket and decodes the response into out.
+// Errors are expected as {"error": "..."}, the way the rclone remote control API returns them.
+func unixSocketCall(ctx context.Context, socketPath, method string, in, out any) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	if in == nil {
+		in = map[string]any{}
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	// the host is ignored, we always dial the socket
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/"+method, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		var respErr struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&respErr); err != nil || respErr.Error == "" {
+			return errors.New(resp.Status)
+		}
+		return errors.New(respErr.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// vfsStats is the part of the vfs/stats response we care about.
+type vfsStats struct {
+	DiskCache struct {
+		BytesUsed         int64 `json:"bytesUsed"`
+		UploadsInProgress int   `json:"uploadsInProgress"`
+		UploadsQueued     int   `json:"uploadsQueued"`
+	} `json:"diskCache"`
+}
+
+func getVFSStats(ctx context.Context, driveName string) (vfsStats, error) {
+	var out vfsStats
+	err := rcCall(ctx, driveName, "vfs/stats", nil, &out)
+	return out, err
+}
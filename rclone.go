@@ -3,8 +3,8 @@ package main
 import (
 	"context"
 	"fmt"
-
 	"log"
+	"slices"
 
 	"github.com/adfinis/adfinis-rclone-mgr/models"
 	"github.com/rclone/rclone/fs/config"
@@ -22,11 +22,21 @@ func init() {
 func handleRcloneConfig(ctx context.Context, drives []models.Drive, clientID, clientSecret, token string) error {
 	// add drives
 	for _, drive := range drives {
-		driveName := sanitizeDriveName(drive.Name)
+		driveName := driveMountName(drive)
 		if drive.Enabled {
 			var configMap rc.Params
-			switch drive.ID {
-			case "my_drive":
+			switch {
+			case drive.Folder:
+				configMap = rc.Params{
+					"type":           "drive",
+					"team_drive":     drive.TeamDrive,
+					"root_folder_id": drive.ID,
+					"scope":          "drive",
+					"client_id":      clientID,
+					"client_secret":  clientSecret,
+					"token":          token,
+				}
+			case drive.ID == "my_drive":
 				configMap = rc.Params{
 					"type":           "drive",
 					"root_folder_id": "",
@@ -35,7 +45,7 @@ func handleRcloneConfig(ctx context.Context, drives []models.Drive, clientID, cl
 					"client_secret":  clientSecret,
 					"token":          token,
 				}
-			case "shared_with_me":
+			case drive.ID == "shared_with_me":
 				configMap = rc.Params{
 					"type":           "drive",
 					"root_folder_id": "",
@@ -61,9 +71,13 @@ func handleRcloneConfig(ctx context.Context, drives []models.Drive, clientID, cl
 			if err != nil {
 				return fmt.Errorf("failed to create remote %s: %w", driveName, err)
 			}
+			if err := writeMountEnv(driveName, drive.Profile); err != nil {
+				return err
+			}
 			log.Printf("Added remote %q", driveName)
 		} else {
-			// remove the remote if it exists
+			// remove the remote if it exists, the drive might still be configured under its old name
+			driveName = driveRemoteName(drive)
 			log.Printf("Removing remote %q", driveName)
 			config.DeleteRemote(driveName)
 		}
@@ -74,3 +88,137 @@ func handleRcloneConfig(ctx context.Context, drives []models.Drive, clientID, cl
 func getRemotes() []string {
 	return config.GetRemoteNames()
 }
+
+// driveRemotes returns the drive remotes of the profile using the client, these are the ones gdrive-config manages.
+// Profiles might share a client, their remotes are told apart by profile.
+func driveRemotes(clientID, profile string) []string {
+	var remotes []string
+	for _, name := range config.FileSections() {
+		if t, _ := config.FileGetValue(name, "type"); t != "drive" {
+			continue
+		}
+		if id, _ := config.FileGetValue(name, "client_id"); id != clientID {
+			continue
+		}
+		if remoteProfile(name) != profile {
+			continue
+		}
+		remotes = append(remotes, name)
+	}
+	return remotes
+}
+
+// remoteDriveID returns the ID of the drive a remote mounts, or "" if it isn't a drive remote.
+// For a remote of a single folder it's the ID of the folder.
+func remoteDriveID(name string) string {
+	if t, _ := config.FileGetValue(name, "type"); t != "drive" {
+		return ""
+	}
+	if id, _ := config.FileGetValue(name, "root_folder_id"); id != "" {
+		return id
+	}
+	if id, _ := config.FileGetValue(name, "team_drive"); id != "" {
+		return id
+	}
+	if v, _ := config.FileGetValue(name, "shared_with_me"); v == "true" {
+		return "shared_with_me"
+	}
+	return "my_drive"
+}
+
+// folderRemoteIDs returns the IDs of the folders mounted by the drive remotes of the client in the profile.
+func folderRemoteIDs(clientID, profile string) []string {
+	var ids []string
+	for _, name := range driveRemotes(clientID, profile) {
+		if id, _ := config.FileGetValue(name, "root_folder_id"); id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// driveRemoteIDs maps all drive remotes to the ID of their drive.
+func driveRemoteIDs() map[string]string {
+	ids := map[string]string{}
+	for _, name := range config.FileSections() {
+		if id := remoteDriveID(name); id != "" {
+			ids[name] = id
+		}
+	}
+	return ids
+}
+
+// renameRemote moves a remote to a new name in rclone.conf.
+func renameRemote(from, to string) error {
+	data := config.LoadedData()
+	if !data.HasSection(from) {
+		return fmt.Errorf("remote %q not found", from)
+	}
+	if data.HasSection(to) {
+		return fmt.Errorf("remote %q exists already", to)
+	}
+	for _, key := range data.GetKeyList(from) {
+		value, _ := data.GetValue(from, key)
+		data.SetValue(to, key, value)
+	}
+	data.DeleteSection(from)
+	config.SaveConfig()
+	return nil
+}
+
+// remoteToken returns the token of a drive remote of the profile using the client, if there is one.
+func remoteToken(clientID, profile string) string {
+	for _, name := range driveRemotes(clientID, profile) {
+		if token, ok := config.FileGetValue(name, "token"); ok && token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+// remoteTokens returns the tokens of the drive remotes of the profile using the client by remote name.
+func remoteTokens(clientID, profile string) map[string]string {
+	tokens := map[string]string{}
+	for _, name := range driveRemotes(clientID, profile) {
+		tokens[name], _ = config.FileGetValue(name, "token")
+	}
+	return tokens
+}
+
+// setRemoteTokens writes the token into all drive remotes of the profile using the client and returns their names.
+func setRemoteTokens(clientID, profile, token string) []string {
+	remotes := driveRemotes(clientID, profile)
+	if len(remotes) == 0 {
+		return nil
+	}
+	data := config.LoadedData()
+	for _, name := range remotes {
+		data.SetValue(name, "token", token)
+	}
+	config.SaveConfig()
+	return remotes
+}
+
+// remoteCredentials returns the client of the first drive remote of the profile, for when the keyring is empty.
+func remoteCredentials(profile string) (clientID, clientSecret string) {
+	for _, name := range config.FileSections() {
+		if t, _ := config.FileGetValue(name, "type"); t != "drive" {
+			continue
+		}
+		if remoteProfile(name) != profile {
+			continue
+		}
+		clientID, clientSecret = remoteClient(name)
+		if clientID != "" && clientSecret != "" {
+			return clientID, clientSecret
+		}
+	}
+	return "", ""
+}
+
+// remoteClient returns the client a remote uses, it identifies the account of the remote.
+func remoteClient(name string) (clientID, clientSecret string) {
+	clientID, _ = config.FileGetValue(name, "client_id")
+	clientSecret, _ = config.FileGetValue(name, "client_secret")
+	return clientID, clientSecret
+}
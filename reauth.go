@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/adfinis/adfinis-rclone-mgr/templates"
+	"github.com/adrg/xdg"
+	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
+)
+
+// accountToken is a token shared by some of the remotes of an account.
+type accountToken struct {
+	Remotes []string
+	// Token is nil if the remotes have no usable token
+	Token *oauth2.Token
+	// Err is why the token doesn't work
+	Err error
+}
+
+// groupTokens groups the remotes by their refresh token, every login gives all remotes the same one.
+// rclone refreshes the access token of each remote on its own, so only the refresh token has to match.
+func groupTokens(tokens map[string]string) []accountToken {
+	var groups []accountToken
+	byRefreshToken := map[string]int{}
+	for _, name := range slices.Sorted(maps.Keys(tokens)) {
+		token := &oauth2.Token{}
+		if err := json.Unmarshal([]byte(tokens[name]), token); err != nil || token.RefreshToken == "" {
+			groups = append(groups, accountToken{Remotes: []string{name}, Err: errors.New("no valid token")})
+			continue
+		}
+		if i, ok := byRefreshToken[token.RefreshToken]; ok {
+			groups[i].Remotes = append(groups[i].Remotes, name)
+			continue
+		}
+		byRefreshToken[token.RefreshToken] = len(groups)
+		groups = append(groups, accountToken{Remotes: []string{name}, Token: token})
+	}
+	return groups
+}
+
+// verifyTokens refreshes every token once, Google rejects the ones that expired or were revoked.
+func verifyTokens(ctx context.Context, oauthConfig *oauth2.Config, groups []accountToken) []accountToken {
+	verified := slices.Clone(groups)
+	for i, g := range verified {
+		if g.Token == nil {
+			continue
+		}
+		// without an access token the refresh token has to be used
+		if _, err := oauthConfig.TokenSource(ctx, &oauth2.Token{RefreshToken: g.Token.RefreshToken}).Token(); err != nil {
+			verified[i].Err = fmt.Errorf("expired or revoked: %w", err)
+		}
+	}
+	return verified
+}
+
+// printTokenCheck shows which remotes use which token and returns false if a reauth is needed.
+func printTokenCheck(out io.Writer, groups []accountToken) bool {
+	if len(groups) == 0 {
+		fmt.Fprintln(out, "No remotes found")
+		return true
+	}
+	ok := len(groups) == 1 && groups[0].Err == nil
+	if len(groups) > 1 {
+		fmt.Fprintf(out, "The remotes use %d different tokens:\n", len(groups))
+	}
+	for _, g := range groups {
+		state := "valid"
+		if g.Err != nil {
+			state = g.Err.Error()
+		}
+		fmt.Fprintf(out, "- %s: %s\n", strings.Join(g.Remotes, ", "), state)
+	}
+	if !ok {
+		fmt.Fprintf(out, "Run 'adfinis-rclone-mgr reauth%s' to give all of them a fresh token\n", profileFlag(activeProfile))
+	}
+	return ok
+}
+
+// browserLogin runs only the login of gdrive-config in the browser and returns the token.
+func browserLogin(ctx context.Context, oauthConfig *oauth2.Config) (*oauth2.Token, error) {
+	state := rand.Text()
+	verifier := oauth2.GenerateVerifier()
+	type result struct {
+		token *oauth2.Token
+		err   error
+	}
+	results := make(chan result, 1)
+	done := func(r result) {
+		select {
+		case results <- r:
+		default:
+		}
+	}
+
+	router := http.NewServeMux()
+	router.Handle("GET /static/", http.FileServerFS(templates.Static))
+	router.HandleFunc("GET /auth", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != state {
+			http.Error(w, "Invalid state parameter", http.StatusBadRequest)
+			return
+		}
+		if e := r.URL.Query().Get("error"); e != "" {
+			err := fmt.Errorf("login failed: %s", e)
+			renderError(ctx, w, http.StatusBadRequest, err)
+			done(result{err: err})
+			return
+		}
+		token, err := oauthConfig.Exchange(ctx, r.URL.Query().Get("code"), oauth2.VerifierOption(verifier))
+		if err != nil {
+			err = fmt.Errorf("failed to exchange token: %w", err)
+			renderError(ctx, w, http.StatusInternalServerError, err)
+			done(result{err: err})
+			return
+		}
+		if err := templates.ComponentLoginRenewed().Render(ctx, w); err != nil {
+			log.Printf("Failed to render template: %v", err)
+		}
+		done(result{token: token})
+	})
+
+	srv := &http.Server{
+		Handler:           loopbackOnly(securityHeaders(router)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if err := serveLoopback(srv); err != nil {
+		return nil, err
+	}
+	defer func() {
+		ctxShutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctxShutdown); err != nil {
+			log.Printf("Server shutdown error: %v", err)
+		}
+	}()
+
+	authURL := oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
+	log.Printf("Visit %s to log in", authURL)
+	openBrowser(authURL)
+
+	select {
+	case r := <-results:
+		return r.token, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(time.Hour):
+		return nil, errors.New("login timed out")
+	}
+}
+
+// restartMounted restarts the remotes that are mounted, rclone only reads the token when it starts.
+func restartMounted(ctx context.Context, sm serviceManager, names []string) error {
+	active, err := activeDrives(ctx, sm)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range names {
+		if !slices.Contains(active, name) {
+			continue
+		}
+		if err := restartService(ctx, sm, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors("Failed to restart mounts", errs)
+}
+
+// saveAccountToken writes the token into the keyring and all remotes of the account, mounted remotes are restarted.
+func saveAccountToken(ctx context.Context, clientID string, token *oauth2.Token) ([]string, error) {
+	tokenString, err := json.Marshal(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize token: %w", err)
+	}
+	if err := setToken(string(tokenString)); err != nil {
+		log.Printf("Failed to save token in keyring: %v", err)
+	}
+	updated := setRemoteTokens(clientID, activeProfile, string(tokenString))
+	// a login that expires again is asked about right away
+	if err := resetAuthPrompt(activeProfile); err != nil {
+		log.Println(err)
+	}
+	if len(updated) == 0 {
+		return nil, nil
+	}
+	sm, err := newServiceManager(ctx)
+	if err != nil {
+		log.Printf("Failed to restart the mounts, remount them to use the new token: %v", err)
+		return updated, nil
+	}
+	defer sm.Close()
+	return updated, restartMounted(ctx, sm, updated)
+}
+
+// authPromptCooldown keeps the readers from asking again while the question is open or the login didn't go through.
+const authPromptCooldown = time.Hour
+
+// reauthUnitName is the transient unit the login runs in, restarting the mounts stops their journald readers.
+const reauthUnitName = "adfinis-rclone-mgr-reauth"
+
+// claimAuthPrompt reports whether the caller should ask to log in again to the account of the profile,
+// only one caller gets to ask per cooldown. Once the user declined, nobody asks until the login is renewed.
+func claimAuthPrompt(profile string, now time.Time) (bool, error) {
+	claimed := false
+	err := updateState(func(s *managerState) error {
+		p := s.authPrompt(profile)
+		if p.Declined || now.Sub(p.PromptedAt) < authPromptCooldown {
+			return nil
+		}
+		p.PromptedAt = now
+		s.setAuthPrompt(profile, p)
+		claimed = true
+		return nil
+	})
+	return claimed, err
+}
+
+// declineAuthPrompt keeps the readers from asking again about the profile after "Not now".
+func declineAuthPrompt(profile string) error {
+	if err := updateState(func(s *managerState) error {
+		p := s.authPrompt(profile)
+		p.Declined = true
+		s.setAuthPrompt(profile, p)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to save the declined login prompt: %w", err)
+	}
+	return nil
+}
+
+// resetAuthPrompt lets the readers ask again the next time the login of the profile expires.
+func resetAuthPrompt(profile string) error {
+	if err := updateState(func(s *managerState) error {
+		s.setAuthPrompt(profile, authPromptState{})
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to reset the login prompt: %w", err)
+	}
+	return nil
+}
+
+// systemdUserRunning reports whether there is a systemd user instance to start transient units in.
+func systemdUserRunning() bool {
+	_, err := os.Stat(path.Join(xdg.RuntimeDir, "systemd", "private"))
+	return err == nil
+}
+
+// startReauthPrompt runs 'reauth --expired' in a transient unit, it outlives the journald reader.
+// Under 'adfinis-rclone-mgr supervise' there are no units, the supervisor keeps running while the mounts restart
+// and starts it as its child instead.
+func startReauthPrompt(driveName string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+	if !systemdUserRunning() {
+		cmd := exec.Command(exe, "reauth", "--expired", driveName)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("failed to start reauth: %w", err)
+		}
+		go cmd.Wait() // nolint:errcheck
+		return nil
+	}
+	cmd := exec.Command("systemd-run", "--user", "--collect", "--unit", reauthUnitName, exe, "reauth", "--expired", driveName)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to start %s: %w: %s", reauthUnitName, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// askReauth asks whether to log in again, false if the user declined.
+func askReauth() (bool, error) {
+	cmd := exec.Command(
+		"zenity", "--question",
+		"--title", "Google Login Expired",
+		"--text", "Your Google login expired – re-authenticate?",
+		"--ok-label", "Log in",
+		"--cancel-label", "Not now",
+	)
+	if err := cmd.Run(); err != nil {
+		if zenityCanceled(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to ask about the login: %w", err)
+	}
+	return true, nil
+}
+
+// reauthCredentials returns the client of the remote whose login expired, or the saved one.
+func reauthCredentials(remote string) (string, string) {
+	if remote != "" {
+		return remoteClient(remote)
+	}
+	return savedCredentials()
+}
+
+func reauth(cmd *cobra.Command, _ []string) {
+	ctx := cmd.Context()
+	expired := reauthCmdFlags.Expired
+	if expired != "" {
+		activeProfile = remoteProfile(expired)
+	} else {
+		useProfile(reauthCmdFlags.Profile)
+	}
+	clientID, clientSecret := reauthCredentials(expired)
+	if clientID == "" {
+		log.Fatalln("No client_id and client_secret found, run 'adfinis-rclone-mgr gdrive-config' once")
+	}
+	oauthConfig := newOAuthConfig(clientID, clientSecret)
+
+	if reauthCmdFlags.Check {
+		groups := verifyTokens(ctx, oauthConfig, groupTokens(remoteTokens(clientID, activeProfile)))
+		if !printTokenCheck(cmd.OutOrStdout(), groups) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if expired != "" {
+		ok, err := askReauth()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if !ok {
+			if err := declineAuthPrompt(activeProfile); err != nil {
+				log.Println(err)
+			}
+			message := fmt.Sprintf("Run 'adfinis-rclone-mgr reauth%s' to log in again, you won't be asked until then.", profileFlag(activeProfile))
+			if err := sendDesktopNotificationInfo("Google Login Expired", message); err != nil {
+				log.Println(err)
+			}
+			return
+		}
+	} else if err := resetAuthPrompt(activeProfile); err != nil {
+		// run by hand, the readers may ask again if it doesn't work out
+		log.Println(err)
+	}
+	updated, err := renewLogin(cmd, oauthConfig)
+	if err != nil {
+		// there is no terminal when the journald reader asked
+		if expired != "" {
+			if err := sendDesktopNotificationError("Google Login Failed", err.Error()); err != nil {
+				log.Println(err)
+			}
+		}
+		log.Fatalln(err)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Renewed the login of %d remotes\n", len(updated))
+	if expired != "" {
+		if err := sendDesktopNotificationInfo("Google Login Renewed", "Your drives use the new login:\n"+strings.Join(updated, "\n")); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// renewLogin logs in again and gives all remotes of the account the new token.
+func renewLogin(cmd *cobra.Command, oauthConfig *oauth2.Config) ([]string, error) {
+	login := browserLogin
+	if reauthCmdFlags.NoBrowser {
+		login = newTerminalPrompt(cmd.InOrStdin(), cmd.OutOrStdout()).login
+	}
+	token, err := login(cmd.Context(), oauthConfig)
+	if err != nil {
+		return nil, err
+	}
+	return saveAccountToken(cmd.Context(), oauthConfig.ClientID, token)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+const testTokenConfig = `
+[My_Drive]
+type = drive
+client_id = ours
+token = {"access_token":"a1","refresh_token":"r1","expiry":"2026-01-01T00:00:00Z"}
+
+[Team]
+type = drive
+team_drive = 0AAA
+client_id = ours
+token = {"access_token":"a2","refresh_token":"r1","expiry":"2026-02-01T00:00:00Z"}
+
+[Old]
+type = drive
+team_drive = 0BBB
+client_id = ours
+token = {"access_token":"a3","refresh_token":"r0"}
+
+[Broken]
+type = drive
+team_drive = 0CCC
+client_id = ours
+token = nope
+
+[Personal]
+type = drive
+client_id = theirs
+token = {"access_token":"x","refresh_token":"other"}
+`
+
+func TestGroupTokens(t *testing.T) {
+	useTempRcloneConfig(t, testTokenConfig)
+
+	groups := groupTokens(remoteTokens("ours", ""))
+	if !assert.Len(t, groups, 3) {
+		return
+	}
+	assert.Equal(t, []string{"Broken"}, groups[0].Remotes)
+	assert.Nil(t, groups[0].Token)
+	assert.Error(t, groups[0].Err)
+	// the access tokens differ, rclone refreshes them for each remote on its own
+	assert.Equal(t, []string{"My_Drive", "Team"}, groups[1].Remotes)
+	assert.Equal(t, "r1", groups[1].Token.RefreshToken)
+	assert.Equal(t, []string{"Old"}, groups[2].Remotes)
+}
+
+func TestVerifyTokens(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("refresh_token") == "r0" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error": "invalid_grant", "error_description": "Token has been expired or revoked."}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token": "fresh", "token_type": "Bearer", "expires_in": 3600}`))
+	}))
+	defer srv.Close()
+	oauthConfig := &oauth2.Config{ClientID: "ours", Endpoint: oauth2.Endpoint{TokenURL: srv.URL}}
+
+	groups := verifyTokens(context.Background(), oauthConfig, []accountToken{
+		{Remotes: []string{"My_Drive"}, Token: &oauth2.Token{RefreshToken: "r1"}},
+		{Remotes: []string{"Old"}, Token: &oauth2.Token{RefreshToken: "r0"}},
+	})
+	assert.NoError(t, groups[0].Err)
+	assert.ErrorContains(t, groups[1].Err, "invalid_grant")
+}
+
+func TestPrintTokenCheck(t *testing.T) {
+	var out bytes.Buffer
+	assert.True(t, printTokenCheck(&out, []accountToken{{Remotes: []string{"My_Drive", "Team"}, Token: &oauth2.Token{}}}))
+	assert.Equal(t, "- My_Drive, Team: valid\n", out.String())
+
+	out.Reset()
+	assert.False(t, printTokenCheck(&out, []accountToken{
+		{Remotes: []string{"My_Drive"}, Token: &oauth2.Token{}},
+		{Remotes: []string{"Old"}, Token: &oauth2.Token{}},
+	}))
+	assert.Contains(t, out.String(), "The remotes use 2 different tokens:\n")
+	assert.Contains(t, out.String(), "reauth")
+}
+
+func TestSetRemoteTokens(t *testing.T) {
+	useTempRcloneConfig(t, testTokenConfig)
+
+	updated := setRemoteTokens("ours", "", `{"access_token":"new","refresh_token":"r2"}`)
+	assert.Equal(t, []string{"My_Drive", "Team", "Old", "Broken"}, updated)
+	groups := groupTokens(remoteTokens("ours", ""))
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, "r2", groups[0].Token.RefreshToken)
+	}
+	// other accounts keep their token
+	assert.Equal(t, "other", groupTokens(remoteTokens("theirs", ""))[0].Token.RefreshToken)
+}
+
+func TestRestartMounted(t *testing.T) {
+	useTempRcloneConfig(t, testTokenConfig)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	assert.NoError(t, sm.StartUnit(ctx, "rclone@Team.service"))
+
+	assert.NoError(t, restartMounted(ctx, sm, []string{"My_Drive", "Team"}))
+	assert.Equal(t, 1, sm.jobCount("restart", "rclone@Team.service"))
+	// not mounted, it reads the new token when it's mounted
+	assert.Equal(t, 0, sm.jobCount("restart", "rclone@My_Drive.service"))
+
+	sm.setJobResult("restart", "rclone@Team.service", "failed")
+	assert.Error(t, restartMounted(ctx, sm, []string{"Team"}))
+}
+
+func TestClaimAuthPrompt(t *testing.T) {
+	useTempDirs(t)
+	now := time.Now()
+
+	claimed, err := claimAuthPrompt("", now)
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	// the readers of the other drives see the same error
+	claimed, err = claimAuthPrompt("", now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+	claimed, err = claimAuthPrompt("", now.Add(authPromptCooldown))
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	// "Not now" holds until the login is renewed
+	assert.NoError(t, declineAuthPrompt(""))
+	claimed, err = claimAuthPrompt("", now.Add(24*authPromptCooldown))
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+	// the account of another profile is asked about on its own
+	claimed, err = claimAuthPrompt("acme", now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	assert.NoError(t, resetAuthPrompt(""))
+	claimed, err = claimAuthPrompt("", now.Add(24*authPromptCooldown))
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	// renewing the default login doesn't touch acme
+	claimed, err = claimAuthPrompt("acme", now.Add(2*time.Second))
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+}
+
+func TestReauthCredentials(t *testing.T) {
+	useTempRcloneConfig(t, testTokenConfig+`
+[Other_Account]
+type = drive
+client_id = other
+client_secret = other-secret
+`)
+
+	clientID, clientSecret := reauthCredentials("Other_Account")
+	assert.Equal(t, "other", clientID)
+	assert.Equal(t, "other-secret", clientSecret)
+}
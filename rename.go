@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"github.com/spf13/cobra"
+)
+
+// withRemotes sets the remote each drive is configured as, found by the drive ID in rclone.conf.
+// remoteIDs are all drive remotes by ID, managed are the ones gdrive-config created with the current client.
+// A remote named like the drive always belongs to it, a remote with another name only if it's managed,
+// so a remote set up by hand is never renamed.
+func withRemotes(drives []models.Drive, remoteIDs map[string]string, managed []string) []models.Drive {
+	found := slices.Clone(drives)
+	for i, d := range found {
+		found[i].Remote = ""
+		if name := driveMountName(d); remoteIDs[name] == d.ID {
+			found[i].Remote = name
+			continue
+		}
+		for _, name := range managed {
+			if remoteIDs[name] == d.ID {
+				found[i].Remote = name
+				break
+			}
+		}
+	}
+	return found
+}
+
+// moveDir moves a directory of a drive, a missing source is skipped and an empty target is replaced.
+func moveDir(from, to string) error {
+	if _, err := os.Stat(from); os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.Remove(to); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to move %s to %s: %w", from, to, err)
+	}
+	if err := ensureFolderExists(path.Dir(to)); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", from, to, err)
+	}
+	return nil
+}
+
+// checkRenameTarget makes sure a directory the rename moves to is missing or empty, moveDir only replaces empty ones.
+func checkRenameTarget(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", dir, err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%s exists already and isn't empty", dir)
+	}
+	return nil
+}
+
+// renameDrive renames the remote of a drive together with its mountpoint, cache, unit and settings.
+// The drive is unmounted for the rename and mounted again afterwards if it was mounted before.
+// If the rename stops halfway, the drive is mounted again under the name its remote has.
+func renameDrive(ctx context.Context, sm serviceManager, from, to string) error {
+	remotes := getRemotes()
+	if !slices.Contains(remotes, from) {
+		return fmt.Errorf("remote %q not found", from)
+	}
+	if slices.Contains(remotes, to) {
+		return fmt.Errorf("%q is already used by another remote", to)
+	}
+	// the drive stays in its profile
+	profile := remoteProfile(from)
+	for _, dir := range []string{profileMountPath(profile, to), getDriveCachePath(to)} {
+		if err := checkRenameTarget(dir); err != nil {
+			return fmt.Errorf("can't rename %q to %q: %w", from, to, err)
+		}
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	enabled, err := isServiceEnabled(ctx, sm, from)
+	if err != nil {
+		return err
+	}
+	active, err := activeDrives(ctx, sm)
+	if err != nil {
+		return err
+	}
+	mounted := slices.Contains(active, from)
+
+	if mounted {
+		if err := stopService(ctx, sm, from); err != nil {
+			return err
+		}
+	}
+	if enabled {
+		if err := disableService(ctx, sm, from); err != nil {
+			return errors.Join(err, restoreDrive(ctx, sm, from, false, mounted))
+		}
+	}
+	if err := moveDrive(cfg, from, to, profile); err != nil {
+		name := from
+		if slices.Contains(getRemotes(), to) {
+			name = to
+		}
+		err = fmt.Errorf("renaming %q to %q stopped halfway, the remote is called %q now and its files might be in the directories of both names: %w", from, to, name, err)
+		return errors.Join(err, restoreDrive(ctx, sm, name, enabled, mounted))
+	}
+	if err := restoreDrive(ctx, sm, to, enabled, mounted); err != nil {
+		return err
+	}
+	log.Printf("Renamed %q to %q", from, to)
+	return nil
+}
+
+// moveDrive renames the remote, moves its directories and settings, the drive has to be unmounted.
+func moveDrive(cfg *managerConfig, from, to, profile string) error {
+	if err := renameRemote(from, to); err != nil {
+		return err
+	}
+	// the mountpoint of the new name is only known once its env file is there
+	if err := writeMountEnv(to, profile); err != nil {
+		return err
+	}
+	if err := moveDir(getDriveDataPath(from), getDriveDataPath(to)); err != nil {
+		return err
+	}
+	if err := removeMountEnv(from); err != nil {
+		return err
+	}
+	// rclone keeps the cache of a remote under its name, moving it keeps pending uploads
+	if err := moveDir(getDriveCachePath(from), getDriveCachePath(to)); err != nil {
+		return err
+	}
+	for _, dir := range []string{"vfs", "vfsMeta"} {
+		if err := moveDir(path.Join(getDriveCachePath(to), dir, from), path.Join(getDriveCachePath(to), dir, to)); err != nil {
+			return err
+		}
+	}
+	cfg.renameDrive(from, to)
+	return cfg.save()
+}
+
+// restoreDrive enables and mounts the drive again, as it was before the rename.
+func restoreDrive(ctx context.Context, sm serviceManager, name string, enabled, mounted bool) error {
+	if enabled {
+		if err := enableService(ctx, sm, name); err != nil {
+			return err
+		}
+	}
+	if mounted {
+		if err := ensureFolderExists(getDriveDataPath(name)); err != nil {
+			return err
+		}
+		if err := startService(ctx, sm, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameDrives renames the drives that got a new name and returns them with their new remote.
+func renameDrives(ctx context.Context, sm serviceManager, drives []models.Drive) ([]models.Drive, error) {
+	renamed := slices.Clone(drives)
+	var errs []error
+	for i, d := range renamed {
+		if !needsRename(d) {
+			continue
+		}
+		name := driveMountName(d)
+		if err := renameDrive(ctx, sm, d.Remote, name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		renamed[i].Remote = name
+	}
+	return renamed, joinErrors("Failed to rename drives", errs)
+}
+
+func handleRenames(ctx context.Context, drives []models.Drive) ([]models.Drive, error) {
+	if !slices.ContainsFunc(drives, needsRename) {
+		return drives, nil
+	}
+	sm, err := newServiceManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer sm.Close()
+	return renameDrives(ctx, sm, drives)
+}
+
+func renameArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	// only the drive can be completed, the new name is up to the user
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return availableMountsForArgs(cmd, args, toComplete)
+}
+
+func rename(cmd *cobra.Command, args []string) {
+	from, localName := args[0], args[1]
+	if err := validateLocalName(localName); err != nil {
+		log.Fatalln(err)
+	}
+	id := remoteDriveID(from)
+	if id == "" {
+		log.Fatalf("%q isn't a Google Drive remote", from)
+	}
+	// the new name gets the prefix of the profile of the drive
+	profile := remoteProfile(from)
+	to := profilePrefix(profile) + localName
+
+	sm, err := newServiceManager(cmd.Context())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer sm.Close()
+	if err := renameDrive(cmd.Context(), sm, from, to); err != nil {
+		log.Fatalln("Failed to rename drive:", err)
+	}
+
+	// gdrive-config keeps the name
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalln("Failed to load config:", err)
+	}
+	cfg.setLocalName(localNameKey(profile, id), localName)
+	if err := cfg.save(); err != nil {
+		log.Fatalln("Failed to save config:", err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/adfinis/adfinis-rclone-mgr/models"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/config/configfile"
+	"github.com/stretchr/testify/assert"
+)
+
+// useTempRcloneConfig points rclone to a temporary rclone.conf with the given content.
+func useTempRcloneConfig(t *testing.T, content string) {
+	t.Helper()
+	configPath := config.GetConfigPath()
+	t.Cleanup(func() {
+		assert.NoError(t, config.SetConfigPath(configPath))
+		configfile.Install()
+	})
+	tmp := filepath.Join(t.TempDir(), "rclone.conf")
+	assert.NoError(t, os.WriteFile(tmp, []byte(content), 0o600))
+	assert.NoError(t, config.SetConfigPath(tmp))
+	configfile.Install()
+}
+
+const testRcloneConfig = `
+[My_Drive]
+type = drive
+client_id = ours
+
+[Old_Name]
+type = drive
+team_drive = 0AAA
+client_id = ours
+
+[A_B]
+type = drive
+team_drive = 0BBB
+client_id = ours
+
+[Shared]
+type = drive
+shared_with_me = true
+client_id = ours
+
+[Personal]
+type = drive
+team_drive = 0CCC
+client_id = theirs
+
+[s3]
+type = s3
+`
+
+func TestDriveRemoteIDs(t *testing.T) {
+	useTempRcloneConfig(t, testRcloneConfig)
+
+	assert.Equal(t, map[string]string{
+		"My_Drive": "my_drive",
+		"Old_Name": "0AAA",
+		"A_B":      "0BBB",
+		"Shared":   "shared_with_me",
+		"Personal": "0CCC",
+	}, driveRemoteIDs())
+	assert.Empty(t, remoteDriveID("s3"))
+}
+
+func TestWithRemotes(t *testing.T) {
+	useTempRcloneConfig(t, testRcloneConfig)
+
+	drives := withRemotes([]models.Drive{
+		{Name: "My Drive", ID: "my_drive"},
+		// renamed in Google Drive
+		{Name: "New Name", ID: "0AAA"},
+		// sanitized to the same name as 0BBB, but it isn't configured
+		{Name: "A/B", ID: "0DDD"},
+		{Name: "A_B", ID: "0BBB"},
+		// the remote was set up by hand with another client
+		{Name: "Team", ID: "0CCC"},
+	}, driveRemoteIDs(), driveRemotes("ours", ""))
+	assert.Equal(t, []string{"My_Drive", "Old_Name", "", "A_B", ""}, []string{
+		drives[0].Remote, drives[1].Remote, drives[2].Remote, drives[3].Remote, drives[4].Remote,
+	})
+	assert.True(t, needsRename(models.Drive{Name: "New Name", Enabled: true, Remote: "Old_Name"}))
+	assert.False(t, needsRename(models.Drive{Name: "New Name", Enabled: true, LocalName: "Old_Name", Remote: "Old_Name"}))
+}
+
+func TestRenameDrive(t *testing.T) {
+	useTempDirs(t)
+	useTempRcloneConfig(t, testRcloneConfig)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+
+	assert.NoError(t, sm.StartUnit(ctx, "rclone@Old_Name.service"))
+	assert.NoError(t, sm.EnableUnit(ctx, "rclone@Old_Name.service"))
+	assert.NoError(t, ensureFolderExists(getDriveDataPath("Old_Name")))
+	// a pending upload
+	upload := path.Join(getDriveCachePath("Old_Name"), "vfs", "Old_Name", "report.odt")
+	assert.NoError(t, ensureFolderExists(path.Dir(upload)))
+	assert.NoError(t, os.WriteFile(upload, []byte("draft"), 0o600))
+	// the new mountpoint was created already
+	assert.NoError(t, ensureFolderExists(getDriveDataPath("New_Name")))
+	cfg := &managerConfig{
+		Drives:    map[string]driveConfig{"Old_Name": {BandwidthSchedule: "08:00,512k"}},
+		Automount: automountConfig{Priority: []string{"My_Drive", "Old_Name"}},
+	}
+	assert.NoError(t, cfg.save())
+
+	assert.Error(t, renameDrive(ctx, sm, "Old_Name", "A_B"))
+	assert.Error(t, renameDrive(ctx, sm, "Missing", "Other"))
+
+	assert.NoError(t, renameDrive(ctx, sm, "Old_Name", "New_Name"))
+	assert.Equal(t, "0AAA", remoteDriveID("New_Name"))
+	assert.NotContains(t, getRemotes(), "Old_Name")
+
+	active, fileState := sm.state("rclone@New_Name.service")
+	assert.Equal(t, "active", active)
+	assert.Equal(t, "enabled", fileState)
+	active, fileState = sm.state("rclone@Old_Name.service")
+	assert.Equal(t, "inactive", active)
+	assert.Equal(t, "disabled", fileState)
+
+	assert.NoDirExists(t, getDriveDataPath("Old_Name"))
+	assert.DirExists(t, getDriveDataPath("New_Name"))
+	assert.FileExists(t, path.Join(getDriveCachePath("New_Name"), "vfs", "New_Name", "report.odt"))
+
+	cfg, err := loadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "08:00,512k", cfg.drive("New_Name").BandwidthSchedule)
+	assert.NotContains(t, cfg.Drives, "Old_Name")
+	assert.Equal(t, []string{"My_Drive", "New_Name"}, cfg.Automount.Priority)
+}
+
+func TestRenameDriveTargetNotEmpty(t *testing.T) {
+	useTempDirs(t)
+	useTempRcloneConfig(t, testRcloneConfig)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	assert.NoError(t, sm.StartUnit(ctx, "rclone@Old_Name.service"))
+	assert.NoError(t, sm.EnableUnit(ctx, "rclone@Old_Name.service"))
+	assert.NoError(t, ensureFolderExists(getDriveDataPath("Old_Name")))
+	assert.NoError(t, ensureFolderExists(path.Join(getDriveDataPath("New_Name"), "notes")))
+
+	// nothing is touched
+	assert.ErrorContains(t, renameDrive(ctx, sm, "Old_Name", "New_Name"), "exists already and isn't empty")
+	assert.Contains(t, getRemotes(), "Old_Name")
+	assert.Equal(t, 0, sm.jobCount("stop", "rclone@Old_Name.service"))
+	active, fileState := sm.state("rclone@Old_Name.service")
+	assert.Equal(t, "active", active)
+	assert.Equal(t, "enabled", fileState)
+}
+
+func TestRenameDriveHalfway(t *testing.T) {
+	useTempDirs(t)
+	useTempRcloneConfig(t, testRcloneConfig)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	assert.NoError(t, sm.StartUnit(ctx, "rclone@Old_Name.service"))
+	assert.NoError(t, sm.EnableUnit(ctx, "rclone@Old_Name.service"))
+	assert.NoError(t, ensureFolderExists(getDriveDataPath("Old_Name")))
+	// a leftover cache of the new name inside the old cache, it can't be replaced
+	assert.NoError(t, ensureFolderExists(path.Join(getDriveCachePath("Old_Name"), "vfs", "Old_Name")))
+	assert.NoError(t, ensureFolderExists(path.Join(getDriveCachePath("Old_Name"), "vfs", "New_Name", "old")))
+
+	err := renameDrive(ctx, sm, "Old_Name", "New_Name")
+	assert.ErrorContains(t, err, `the remote is called "New_Name" now`)
+	// mounted again under the name the remote has
+	assert.Contains(t, getRemotes(), "New_Name")
+	active, fileState := sm.state("rclone@New_Name.service")
+	assert.Equal(t, "active", active)
+	assert.Equal(t, "enabled", fileState)
+	assert.DirExists(t, getDriveDataPath("New_Name"))
+}
+
+func TestRenameDrives(t *testing.T) {
+	useTempDirs(t)
+	useTempRcloneConfig(t, testRcloneConfig)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+
+	drives, err := renameDrives(ctx, sm, []models.Drive{
+		{Name: "New Name", ID: "0AAA", Enabled: true, Remote: "Old_Name"},
+		{Name: "My Drive", ID: "my_drive", Enabled: true, Remote: "My_Drive"},
+		// removed, there is no point in renaming it
+		{Name: "Shared With Me", ID: "shared_with_me", Remote: "Shared"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "New_Name", drives[0].Remote)
+	assert.Equal(t, "Shared", drives[2].Remote)
+	// the drive was neither mounted nor enabled
+	active, fileState := sm.state("rclone@New_Name.service")
+	assert.Equal(t, "inactive", active)
+	assert.Equal(t, "disabled", fileState)
+}
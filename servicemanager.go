@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+// serviceManager controls the units of the mounts and the daemon.
+// All errors of failed jobs already contain the unit name and the job result.
+type serviceManager interface {
+	Reload(ctx context.Context) error
+	StartUnit(ctx context.Context, unitName string) error
+	StopUnit(ctx context.Context, unitName string) error
+	RestartUnit(ctx context.Context, unitName string) error
+	EnableUnit(ctx context.Context, unitName string) error
+	DisableUnit(ctx context.Context, unitName string) error
+	// UnitFileState returns e.g. "enabled", "disabled" or "static"
+	UnitFileState(ctx context.Context, unitName string) (string, error)
+	// Restarts returns the number of automatic restarts of a service
+	Restarts(ctx context.Context, unitName string) (uint32, error)
+	ListUnits(ctx context.Context, unitNames []string) ([]dbus.UnitStatus, error)
+	Close()
+}
+
+// newServiceManager connects to the service manager of the current user.
+// Without a systemd user instance, e.g. in containers, it falls back to a running 'adfinis-rclone-mgr supervise'.
+func newServiceManager(ctx context.Context) (serviceManager, error) {
+	conn, err := dbus.NewUserConnectionContext(ctx)
+	if err == nil {
+		return &systemdManager{conn: conn}, nil
+	}
+	c, supervisorErr := connectSupervisor(ctx, getSupervisorSocketPath())
+	if supervisorErr != nil {
+		return nil, fmt.Errorf("failed to start dbus connection (%w) and no supervisor is running, start one with 'adfinis-rclone-mgr supervise'", err)
+	}
+	return c, nil
+}
+
+// systemdManager talks to the systemd user instance over D-Bus.
+type systemdManager struct {
+	conn *dbus.Conn
+}
+
+func (m *systemdManager) Close() {
+	m.conn.Close()
+}
+
+func (m *systemdManager) Reload(ctx context.Context) error {
+	if err := m.conn.ReloadContext(ctx); err != nil {
+		return fmt.Errorf("failed to reload systemd: %w", err)
+	}
+	return nil
+}
+
+// jobResultError turns a job result like "failed" or "timeout" into an error.
+func jobResultError(op, unitName, result string) error {
+	if result != "done" {
+		return fmt.Errorf("failed to %s service %q: %s", op, unitName, result)
+	}
+	return nil
+}
+
+// waitForJob waits for the result of a job, systemd reports "done" if it succeeded.
+func waitForJob(ctx context.Context, op, unitName string, ch <-chan string) error {
+	select {
+	case result := <-ch:
+		return jobResultError(op, unitName, result)
+	case <-ctx.Done():
+		return fmt.Errorf("failed to %s service %q: %w", op, unitName, ctx.Err())
+	}
+}
+
+func (m *systemdManager) StartUnit(ctx context.Context, unitName string) error {
+	// the channel is buffered, systemd writes to it even if we stopped waiting
+	ch := make(chan string, 1)
+	if _, err := m.conn.StartUnitContext(ctx, unitName, "replace", ch); err != nil {
+		return fmt.Errorf("failed to start service %q: %w", unitName, err)
+	}
+	return waitForJob(ctx, "start", unitName, ch)
+}
+
+func (m *systemdManager) StopUnit(ctx context.Context, unitName string) error {
+	ch := make(chan string, 1)
+	if _, err := m.conn.StopUnitContext(ctx, unitName, "replace", ch); err != nil {
+		return fmt.Errorf("failed to stop service %q: %w", unitName, err)
+	}
+	return waitForJob(ctx, "stop", unitName, ch)
+}
+
+func (m *systemdManager) RestartUnit(ctx context.Context, unitName string) error {
+	ch := make(chan string, 1)
+	if _, err := m.conn.RestartUnitContext(ctx, unitName, "replace", ch); err != nil {
+		return fmt.Errorf("failed to restart service %q: %w", unitName, err)
+	}
+	return waitForJob(ctx, "restart", unitName, ch)
+}
+
+func (m *systemdManager) EnableUnit(ctx context.Context, unitName string) error {
+	if _, _, err := m.conn.EnableUnitFilesContext(ctx, []string{unitName}, false, true); err != nil {
+		return fmt.Errorf("failed to enable service %q: %w", unitName, err)
+	}
+	return nil
+}
+
+func (m *systemdManager) DisableUnit(ctx context.Context, unitName string) error {
+	if _, err := m.conn.DisableUnitFilesContext(ctx, []string{unitName}, false); err != nil {
+		return fmt.Errorf("failed to disable service %q: %w", unitName, err)
+	}
+	return nil
+}
+
+func (m *systemdManager) UnitFileState(ctx context.Context, unitName string) (string, error) {
+	p, err := m.conn.GetUnitPropertyContext(ctx, unitName, "UnitFileState")
+	if err != nil {
+		return "", fmt.Errorf("failed to get unit file state of %q: %w", unitName, err)
+	}
+	state, _ := p.Value.Value().(string)
+	return state, nil
+}
+
+func (m *systemdManager) Restarts(ctx context.Context, unitName string) (uint32, error) {
+	p, err := m.conn.GetServicePropertyContext(ctx, unitName, "NRestarts")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get restarts of %q: %w", unitName, err)
+	}
+	n, _ := p.Value.Value().(uint32)
+	return n, nil
+}
+
+func (m *systemdManager) ListUnits(ctx context.Context, unitNames []string) ([]dbus.UnitStatus, error) {
+	return m.conn.ListUnitsByNamesContext(ctx, unitNames)
+}
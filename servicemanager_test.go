@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeUnit struct {
+	ActiveState   string
+	UnitFileState string
+	Restarts      uint32
+}
+
+// fakeServiceManager keeps the units in memory, jobs succeed unless a different result is set with setJobResult.
+type fakeServiceManager struct {
+	mu         sync.Mutex
+	units      map[string]*fakeUnit
+	jobResults map[string]string
+	// jobs counts the jobs by op and unit, e.g. "start rclone@a.service"
+	jobs    map[string]int
+	reloads int
+	// onJob is called with the op and unit before a job runs, if set
+	onJob func(op, unitName string)
+}
+
+var _ serviceManager = (*fakeServiceManager)(nil)
+
+func newFakeServiceManager() *fakeServiceManager {
+	return &fakeServiceManager{
+		units:      map[string]*fakeUnit{},
+		jobResults: map[string]string{},
+		jobs:       map[string]int{},
+	}
+}
+
+// setJobResult makes every op ("start", "stop" or "restart") job of the unit end with result, e.g. "failed" or "timeout".
+func (f *fakeServiceManager) setJobResult(op, unitName, result string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.jobResults[op+" "+unitName] = result
+}
+
+func (f *fakeServiceManager) unit(unitName string) *fakeUnit {
+	u, ok := f.units[unitName]
+	if !ok {
+		u = &fakeUnit{ActiveState: "inactive", UnitFileState: "disabled"}
+		f.units[unitName] = u
+	}
+	return u
+}
+
+func (f *fakeServiceManager) jobCount(op, unitName string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.jobs[op+" "+unitName]
+}
+
+// state returns the active and unit file state of a unit.
+func (f *fakeServiceManager) state(unitName string) (string, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u := f.unit(unitName)
+	return u.ActiveState, u.UnitFileState
+}
+
+func (f *fakeServiceManager) runJob(ctx context.Context, op, unitName, wantState string) error {
+	if f.onJob != nil {
+		f.onJob(op, unitName)
+	}
+	f.mu.Lock()
+	f.jobs[op+" "+unitName]++
+	result, ok := f.jobResults[op+" "+unitName]
+	if !ok {
+		result = "done"
+	}
+	u := f.unit(unitName)
+	switch {
+	case result == "done":
+		u.ActiveState = wantState
+	case op != "stop":
+		u.ActiveState = "failed"
+	}
+	f.mu.Unlock()
+
+	ch := make(chan string, 1)
+	ch <- result
+	return waitForJob(ctx, op, unitName, ch)
+}
+
+func (f *fakeServiceManager) Reload(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reloads++
+	return nil
+}
+
+func (f *fakeServiceManager) StartUnit(ctx context.Context, unitName string) error {
+	return f.runJob(ctx, "start", unitName, "active")
+}
+
+func (f *fakeServiceManager) StopUnit(ctx context.Context, unitName string) error {
+	return f.runJob(ctx, "stop", unitName, "inactive")
+}
+
+func (f *fakeServiceManager) RestartUnit(ctx context.Context, unitName string) error {
+	err := f.runJob(ctx, "restart", unitName, "active")
+	if err == nil {
+		f.mu.Lock()
+		f.unit(unitName).Restarts++
+		f.mu.Unlock()
+	}
+	return err
+}
+
+func (f *fakeServiceManager) EnableUnit(_ context.Context, unitName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.unit(unitName).UnitFileState = "enabled"
+	return nil
+}
+
+func (f *fakeServiceManager) DisableUnit(_ context.Context, unitName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.unit(unitName).UnitFileState = "disabled"
+	return nil
+}
+
+func (f *fakeServiceManager) UnitFileState(_ context.Context, unitName string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.unit(unitName).UnitFileState, nil
+}
+
+func (f *fakeServiceManager) Restarts(_ context.Context, unitName string) (uint32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.unit(unitName).Restarts, nil
+}
+
+func (f *fakeServiceManager) ListUnits(_ context.Context, unitNames []string) ([]dbus.UnitStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	statuses := make([]dbus.UnitStatus, len(unitNames))
+	for i, name := range unitNames {
+		statuses[i] = dbus.UnitStatus{
+			Name:        name,
+			LoadState:   "loaded",
+			ActiveState: f.unit(name).ActiveState,
+		}
+	}
+	return statuses, nil
+}
+
+func (f *fakeServiceManager) Close() {}
+
+// useTempDirs points all xdg directories to a temporary directory.
+func useTempDirs(t *testing.T) {
+	t.Helper()
+	home, config, cache, state, runtime := xdg.Home, xdg.ConfigHome, xdg.CacheHome, xdg.StateHome, xdg.RuntimeDir
+	t.Cleanup(func() {
+		xdg.Home, xdg.ConfigHome, xdg.CacheHome, xdg.StateHome, xdg.RuntimeDir = home, config, cache, state, runtime
+	})
+	dir := t.TempDir()
+	xdg.Home = dir
+	xdg.ConfigHome = dir + "/config"
+	xdg.CacheHome = dir + "/cache"
+	xdg.StateHome = dir + "/state"
+	xdg.RuntimeDir = dir + "/run"
+}
+
+func TestFakeServiceManagerJobResults(t *testing.T) {
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	sm.setJobResult("start", "rclone@a.service", "timeout")
+
+	err := sm.StartUnit(ctx, "rclone@a.service")
+	assert.EqualError(t, err, `failed to start service "rclone@a.service": timeout`)
+	active, _ := sm.state("rclone@a.service")
+	assert.Equal(t, "failed", active)
+
+	assert.NoError(t, sm.StartUnit(ctx, "rclone@b.service"))
+	assert.NoError(t, sm.RestartUnit(ctx, "rclone@b.service"))
+	n, err := sm.Restarts(ctx, "rclone@b.service")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), n)
+}
+
+func TestWaitForJobCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := waitForJob(ctx, "stop", "rclone@a.service", make(chan string))
+	assert.ErrorIs(t, err, context.Canceled)
+}
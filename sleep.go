@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/login1"
+)
+
+const (
+	// logind only waits InhibitDelayMaxSec (5s by default) for delay locks, no point in waiting longer
+	sleepFlushTimeout = 4 * time.Second
+	// resumeHealthTimeout is how long the root of a mount may take to respond after resume
+	resumeHealthTimeout = 10 * time.Second
+)
+
+var errMountHung = errors.New("mount does not respond")
+
+// checkMountHealth lists the root of a mount and fails if that takes longer than timeout.
+// A hung FUSE mount blocks the syscall forever, so the goroutine is leaked in that case.
+func checkMountHealth(ctx context.Context, mountPath string, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := os.ReadDir(mountPath)
+		done <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %s", errMountHung, mountPath)
+	}
+}
+
+// pendingUploads returns the number of files rclone still has to upload.
+func pendingUploads(ctx context.Context, driveName string) (int, error) {
+	stats, err := getVFSStats(ctx, driveName)
+	if err != nil {
+		return 0, err
+	}
+	return stats.DiskCache.UploadsInProgress + stats.DiskCache.UploadsQueued, nil
+}
+
+// flushUploads lifts the bandwidth limits and waits for pending uploads until ctx is done.
+// rclone has no way to force the upload of the cache, so this is the best we can do.
+func flushUploads(ctx context.Context, drives []string) {
+	for _, name := range drives {
+		if err := setBandwidthLimit(ctx, name, "off"); err != nil {
+			log.Printf("Failed to lift bandwidth limit of %q: %v", name, err)
+		}
+	}
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	pending := drives
+	for len(pending) > 0 {
+		var still []string
+		for _, name := range pending {
+			n, err := pendingUploads(ctx, name)
+			if err != nil || n > 0 {
+				still = append(still, name)
+			}
+		}
+		pending = still
+		if len(pending) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("Going to sleep with pending uploads on %v", pending)
+			return
+		case <-ticker.C:
+		}
+	}
+	log.Println("All uploads flushed")
+}
+
+// restartHungMounts restarts every mount that doesn't respond anymore.
+func (d *mgrDaemon) restartHungMounts(ctx context.Context, drives []string) {
+	for _, name := range drives {
+		err := checkMountHealth(ctx, getDriveDataPath(name), resumeHealthTimeout)
+		if err == nil {
+			continue
+		}
+		log.Printf("Mount %q is unhealthy after resume, restarting: %v", name, err)
+		if err := restartMount(ctx, d.sm, name); err != nil {
+			log.Println(err)
+			continue
+		}
+		log.Printf("Restarted %q", name)
+	}
+}
+
+// restartMount restarts the mount of a drive that doesn't respond anymore.
+// The hung mount is detached first, otherwise stopping rclone blocks on it until systemd kills it.
+func restartMount(ctx context.Context, sm serviceManager, name string) error {
+	lazyUmount(ctx, name)
+	if err := restartService(ctx, sm, name); err != nil {
+		// the stop job failed anyway, try to start it again
+		if err := startService(ctx, sm, name); err != nil {
+			return fmt.Errorf("failed to restart %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// sleepInhibitor holds the delay lock that keeps the system awake until the uploads are flushed.
+type sleepInhibitor struct {
+	take func() (*os.File, error)
+	lock *os.File
+}
+
+// acquire takes the lock, it's released before every sleep and taken again after resume.
+func (i *sleepInhibitor) acquire() {
+	if i.lock != nil {
+		return
+	}
+	lock, err := i.take()
+	if err != nil {
+		log.Printf("Failed to take sleep inhibitor lock: %v", err)
+		return
+	}
+	i.lock = lock
+}
+
+// release lets the system go to sleep.
+func (i *sleepInhibitor) release() {
+	if i.lock != nil {
+		i.lock.Close() // nolint:errcheck
+		i.lock = nil
+	}
+}
+
+// prepareForSleep flushes the uploads of the drives, then lets the system sleep.
+func (d *mgrDaemon) prepareForSleep(ctx context.Context, drives []string, inhibitor *sleepInhibitor) {
+	log.Println("Preparing for sleep")
+	flushCtx, cancel := context.WithTimeout(ctx, sleepFlushTimeout)
+	flushUploads(flushCtx, drives)
+	cancel()
+	inhibitor.release()
+}
+
+// resumeFromSleep restarts the mounts that hung during sleep and restores the bandwidth limits the flush lifted.
+func (d *mgrDaemon) resumeFromSleep(ctx context.Context, drives []string, inhibitor *sleepInhibitor) {
+	log.Println("Resumed from sleep")
+	inhibitor.acquire()
+	d.restartHungMounts(ctx, drives)
+	// restarted mounts lost their limit as well, so this has to come last
+	if err := applyBandwidthLimits(ctx, d.sm); err != nil {
+		log.Println(err)
+	}
+}
+
+func (d *mgrDaemon) runSleepWatcher(ctx context.Context) error {
+	conn, err := login1.New()
+	if err != nil {
+		return fmt.Errorf("failed to connect to logind: %w", err)
+	}
+	defer conn.Close()
+
+	inhibitor := &sleepInhibitor{take: func() (*os.File, error) {
+		return conn.Inhibit("sleep", "adfinis-rclone-mgr", "Flushing pending uploads of rclone mounts", "delay")
+	}}
+	inhibitor.acquire()
+	defer inhibitor.release()
+
+	signals := conn.Subscribe("PrepareForSleep")
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sig, ok := <-signals:
+			if !ok {
+				return fmt.Errorf("lost connection to logind")
+			}
+			if len(sig.Body) == 0 {
+				continue
+			}
+			start, _ := sig.Body[0].(bool)
+			drives, err := activeDrives(ctx, d.sm)
+			if err != nil {
+				log.Println(err)
+			}
+			if start {
+				d.prepareForSleep(ctx, drives, inhibitor)
+			} else {
+				d.resumeFromSleep(ctx, drives, inhibitor)
+			}
+		}
+	}
+}
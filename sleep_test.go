@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckMountHealth(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, checkMountHealth(context.Background(), dir, time.Second))
+
+	err := checkMountHealth(context.Background(), dir+"/does-not-exist", time.Second)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, errMountHung)
+}
+
+// fakeRC is the remote control API of a mount, it records the bandwidth limits set.
+type fakeRC struct {
+	mu      sync.Mutex
+	rate    string
+	rates   []string
+	pending int
+	// onSetRate is called before a limit is set
+	onSetRate func(rate string)
+}
+
+// serveFakeRC serves rc on the socket of the drive, useTempDirs has to be called first.
+func serveFakeRC(t *testing.T, name string, rc *fakeRC) {
+	t.Helper()
+	socketPath := getDriveRCSocketPath(name)
+	assert.NoError(t, ensureFolderExists(path.Dir(socketPath)))
+	listener, err := net.Listen("unix", socketPath)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		switch r.URL.Path {
+		case "/core/bwlimit":
+			var in struct {
+				Rate string `json:"rate"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&in)
+			if in.Rate != "" {
+				if rc.onSetRate != nil {
+					rc.onSetRate(in.Rate)
+				}
+				rc.rate = in.Rate
+				rc.rates = append(rc.rates, in.Rate)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"rate": rc.rate})
+		case "/vfs/stats":
+			var stats vfsStats
+			stats.DiskCache.UploadsQueued = rc.pending
+			if rc.pending > 0 {
+				rc.pending--
+			}
+			_ = json.NewEncoder(w).Encode(stats)
+		default:
+			http.Error(w, `{"error": "unknown method"}`, http.StatusNotFound)
+		}
+	})}
+	go srv.Serve(listener) // nolint:errcheck
+	t.Cleanup(func() { srv.Close() })
+}
+
+func (rc *fakeRC) setRates() []string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return slices.Clone(rc.rates)
+}
+
+func TestFlushUploads(t *testing.T) {
+	useTempDirs(t)
+	rc := &fakeRC{rate: "1Mi", pending: 2}
+	serveFakeRC(t, "My_Drive", rc)
+
+	flushUploads(context.Background(), []string{"My_Drive"})
+	assert.Equal(t, []string{"off"}, rc.setRates())
+	assert.Equal(t, 0, rc.pending)
+
+	// uploads that never finish don't keep the system awake
+	rc.pending = 1000
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	flushUploads(ctx, []string{"My_Drive"})
+	assert.Positive(t, rc.pending)
+}
+
+func TestSleepInhibitor(t *testing.T) {
+	taken := 0
+	var lock *os.File
+	inhibitor := &sleepInhibitor{take: func() (*os.File, error) {
+		taken++
+		var err error
+		lock, err = os.Open(os.DevNull)
+		return lock, err
+	}}
+	inhibitor.acquire()
+	inhibitor.acquire()
+	assert.Equal(t, 1, taken)
+
+	d := &mgrDaemon{sm: newFakeServiceManager()}
+	d.prepareForSleep(context.Background(), nil, inhibitor)
+	assert.Nil(t, inhibitor.lock)
+	// closed, the system can go to sleep
+	assert.ErrorIs(t, lock.Close(), os.ErrClosed)
+
+	inhibitor.take = func() (*os.File, error) { return nil, errors.New("no logind") }
+	inhibitor.acquire()
+	assert.Nil(t, inhibitor.lock)
+}
+
+func TestResumeFromSleep(t *testing.T) {
+	useTempDirs(t)
+	useTempRcloneConfig(t, testRcloneConfig)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	assert.NoError(t, sm.StartUnit(ctx, "rclone@My_Drive.service"))
+	cfg := &managerConfig{Drives: map[string]driveConfig{"My_Drive": {BandwidthSchedule: "512k"}}}
+	assert.NoError(t, cfg.save())
+
+	rc := &fakeRC{rate: "off"}
+	restartedFirst := false
+	rc.onSetRate = func(string) {
+		restartedFirst = sm.jobCount("restart", "rclone@My_Drive.service") == 1
+	}
+	serveFakeRC(t, "My_Drive", rc)
+
+	taken := 0
+	inhibitor := &sleepInhibitor{take: func() (*os.File, error) {
+		taken++
+		return os.Open(os.DevNull)
+	}}
+	defer inhibitor.release()
+	d := &mgrDaemon{sm: sm}
+	// the mountpoint is missing, so the mount counts as broken
+	d.resumeFromSleep(ctx, []string{"My_Drive"}, inhibitor)
+
+	assert.Equal(t, 1, taken)
+	assert.Equal(t, 1, sm.jobCount("restart", "rclone@My_Drive.service"))
+	want, err := effectiveBandwidthLimit(cfg, &managerState{}, "My_Drive", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{want}, rc.setRates())
+	// the restart would have reset a limit set before it
+	assert.True(t, restartedFirst)
+}
+
+// useFakeFusermount puts a fusermount3 on PATH that logs its arguments, it returns the path of the log.
+func useFakeFusermount(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	logPath := path.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"$@\" >> " + logPath + "\n"
+	assert.NoError(t, os.WriteFile(path.Join(dir, "fusermount3"), []byte(script), 0o755))
+	t.Setenv("PATH", dir)
+	return logPath
+}
+
+func TestRestartMountUnmountsFirst(t *testing.T) {
+	useTempDirs(t)
+	logPath := useFakeFusermount(t)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	var umountedBefore []string
+	sm.onJob = func(op, _ string) {
+		calls, _ := os.ReadFile(logPath)
+		umountedBefore = append(umountedBefore, op+" "+string(calls))
+	}
+
+	assert.NoError(t, restartMount(ctx, sm, "My_Drive"))
+	// the hung mount is already detached when systemd stops rclone
+	assert.Equal(t, []string{"restart -uz " + getDriveDataPath("My_Drive") + "\n"}, umountedBefore)
+
+	// the stop job times out on the mount anyway, it's started again
+	assert.NoError(t, os.Remove(logPath))
+	umountedBefore = nil
+	sm.setJobResult("restart", "rclone@My_Drive.service", "timeout")
+	assert.NoError(t, restartMount(ctx, sm, "My_Drive"))
+	assert.Len(t, umountedBefore, 2)
+	assert.Equal(t, "start -uz "+getDriveDataPath("My_Drive")+"\n", umountedBefore[1])
+}
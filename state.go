@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// managerState is shared between the daemon and the command line.
+// Unlike managerConfig it is written by the tool itself and never meant to be edited by hand.
+type managerState struct {
+	// BandwidthOverrides are temporary bandwidth limits keyed by drive name or "all"
+	BandwidthOverrides map[string]bandwidthOverride `json:"bandwidth_overrides,omitempty"`
+	// Network is the connectivity as last seen by the daemon
+	Network networkState `json:"network"`
+	// ErrorCounts are the errors seen by the journald readers, by drive and error class
+	ErrorCounts map[string]map[string]int `json:"error_counts,omitempty"`
+	// Automount is the progress of the daemon starting the enabled drives
+	Automount automountState `json:"automount"`
+	// Idle are the drives unmounted because they weren't used, they are mounted again on access
+	Idle []string `json:"idle,omitempty"`
+	// Health are the drives the watchdog considers unhealthy
+	Health map[string]driveHealth `json:"health,omitempty"`
+	// Interventions are the last actions of the watchdog, oldest first
+	Interventions []watchdogIntervention `json:"interventions,omitempty"`
+	// SupervisedDrives are the drives 'adfinis-rclone-mgr supervise' mounts on startup
+	SupervisedDrives []string `json:"supervised_drives,omitempty"`
+	// Discovery remembers what 'adfinis-rclone-mgr discover' told the user about
+	Discovery discoveryState `json:"discovery"`
+	// ProfileDiscovery is the same for the named profiles, Discovery is the one of the default profile
+	ProfileDiscovery map[string]discoveryState `json:"profile_discovery,omitempty"`
+	// AuthPrompt is whether the login of the default profile was asked about, every account is asked about on its own
+	AuthPrompt authPromptState `json:"auth_prompt"`
+	// ProfileAuthPrompt is the same for the named profiles
+	ProfileAuthPrompt map[string]authPromptState `json:"profile_auth_prompt,omitempty"`
+}
+
+type networkState struct {
+	Offline bool      `json:"offline,omitempty"`
+	Metered bool      `json:"metered,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+}
+
+type automountState struct {
+	// Waiting are the drives waiting for the network
+	Waiting []string `json:"waiting,omitempty"`
+	// Retrying are the drives that failed to mount, by the time of the next attempt
+	Retrying map[string]time.Time `json:"retrying,omitempty"`
+}
+
+type driveHealth struct {
+	Unhealthy bool      `json:"unhealthy"`
+	Since     time.Time `json:"since"`
+}
+
+type watchdogIntervention struct {
+	Time   time.Time `json:"time"`
+	Drive  string    `json:"drive"`
+	Action string    `json:"action"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type discoveryState struct {
+	// KnownDrives are the IDs of the drives the user has seen, in gdrive-config or a notification
+	KnownDrives []string `json:"known_drives,omitempty"`
+	// LostRemotes are the remotes the user was told they lost access to
+	LostRemotes []string `json:"lost_remotes,omitempty"`
+	// LastRun is zero until the first run, which only remembers the drives there are
+	LastRun time.Time `json:"last_run,omitempty"`
+}
+
+type authPromptState struct {
+	// PromptedAt is when a journald reader last asked to log in again, so the readers of all drives of the account ask once
+	PromptedAt time.Time `json:"prompted_at,omitempty"`
+	// Declined is set when the user answered "Not now", nobody asks again until the login is renewed
+	Declined bool `json:"declined,omitempty"`
+}
+
+type bandwidthOverride struct {
+	Rate string `json:"rate"`
+	// Until is the zero time if the override doesn't expire
+	Until time.Time `json:"until,omitempty"`
+}
+
+func (o bandwidthOverride) activeAt(now time.Time) bool {
+	return o.Until.IsZero() || now.Before(o.Until)
+}
+
+// discovery returns what discover told the user about the drives of the profile.
+func (s *managerState) discovery(profile string) discoveryState {
+	if profile == "" {
+		return s.Discovery
+	}
+	return s.ProfileDiscovery[profile]
+}
+
+func (s *managerState) setDiscovery(profile string, d discoveryState) {
+	if profile == "" {
+		s.Discovery = d
+		return
+	}
+	if s.ProfileDiscovery == nil {
+		s.ProfileDiscovery = map[string]discoveryState{}
+	}
+	s.ProfileDiscovery[profile] = d
+}
+
+func (s *managerState) authPrompt(profile string) authPromptState {
+	if profile == "" {
+		return s.AuthPrompt
+	}
+	return s.ProfileAuthPrompt[profile]
+}
+
+func (s *managerState) setAuthPrompt(profile string, p authPromptState) {
+	if profile == "" {
+		s.AuthPrompt = p
+		return
+	}
+	if s.ProfileAuthPrompt == nil {
+		s.ProfileAuthPrompt = map[string]authPromptState{}
+	}
+	s.ProfileAuthPrompt[profile] = p
+}
+
+func getStatePath() string {
+	return path.Join(xdg.StateHome, "adfinis-rclone-mgr", "state.json")
+}
+
+func loadState() (*managerState, error) {
+	return readState(getStatePath())
+}
+
+func readState(statePath string) (*managerState, error) {
+	state := &managerState{}
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read state %s: %w", statePath, err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state %s: %w", statePath, err)
+	}
+	return state, nil
+}
+
+// updateState loads the state, applies fn and writes it back.
+// The state file is locked in the meantime, as the daemon and the cli might update it at the same time.
+func updateState(fn func(*managerState) error) error {
+	return updateStateAt(getStatePath(), fn)
+}
+
+func updateStateAt(statePath string, fn func(*managerState) error) error {
+	if err := ensureFolderExists(path.Dir(statePath)); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(statePath+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open state lock: %w", err)
+	}
+	defer lock.Close() // nolint:errcheck
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock state: %w", err)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN) // nolint:errcheck
+
+	state, err := readState(statePath)
+	if err != nil {
+		return err
+	}
+	if err := fn(state); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	// write to a temporary file first, so readers never see a half written state
+	tmpPath := statePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(tmpPath, statePath); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}
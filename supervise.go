@@ -0,0 +1,708 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// supervisorStartTimeout is how long a mount may take until it shows up in the mount table
+	supervisorStartTimeout = 30 * time.Second
+	// supervisorStopTimeout is how long rclone gets to unmount before it is killed
+	supervisorStopTimeout = 15 * time.Second
+	supervisorMinBackoff  = time.Second
+	supervisorMaxBackoff  = 5 * time.Minute
+	// a mount running for longer than this resets the backoff
+	supervisorStableAfter = time.Minute
+)
+
+func getSupervisorSocketPath() string {
+	return path.Join(xdg.RuntimeDir, "adfinis-rclone-mgr-supervise.sock")
+}
+
+// supervisor runs the rclone mounts as child processes for systems without a systemd user instance.
+// It implements serviceManager for the rclone@.service units, the daemon unit is the supervisor itself.
+type supervisor struct {
+	mu     sync.Mutex
+	mounts map[string]*supervisedMount
+	// command returns the command line of the mount of a drive
+	command func(name string) ([]string, error)
+	// isMounted reports whether the mount of a drive is up
+	isMounted func(mountPath string) bool
+}
+
+type supervisedMount struct {
+	name        string
+	activeState string
+	restarts    uint32
+	// started receives the result of the initial start, it's nil once the result was sent
+	started  chan string
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newSupervisor() *supervisor {
+	return &supervisor{
+		mounts:    map[string]*supervisedMount{},
+		command:   rcloneMountCommand,
+		isMounted: isMountPoint,
+	}
+}
+
+// parseExecStart returns the ExecStart= command line of a unit, split into arguments.
+func parseExecStart(content string) []string {
+	var line string
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		l := strings.TrimSpace(scanner.Text())
+		if line == "" && !strings.HasPrefix(l, "ExecStart=") {
+			continue
+		}
+		line += strings.TrimSuffix(l, "\\") + " "
+		if !strings.HasSuffix(l, "\\") {
+			break
+		}
+	}
+	line = strings.TrimPrefix(line, "ExecStart=")
+
+	var args []string
+	var current strings.Builder
+	inQuotes, inArg := false, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			inArg = true
+		case r == ' ' && !inQuotes:
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	return args
+}
+
+// expandSpecifiers replaces the systemd specifiers used in our units, and the MOUNT_DIR of rclone@.service.
+func expandSpecifiers(arg, name string) string {
+	return strings.NewReplacer(
+		"${MOUNT_DIR}", getDriveDataPath(name),
+		"%%", "%",
+		"%i", name,
+		"%I", name,
+		"%h", xdg.Home,
+		"%t", xdg.RuntimeDir,
+	).Replace(arg)
+}
+
+// rcloneMountCommand returns the same command line rclone@.service would run for a drive.
+func rcloneMountCommand(name string) ([]string, error) {
+	rclone, err := exec.LookPath("rclone")
+	if err != nil {
+		return nil, fmt.Errorf("rclone not found in PATH: %w", err)
+	}
+	excludeList := excludeListPath
+	if _, err := os.Stat(excludeList); err != nil {
+		excludeList = getUserExcludeListPath()
+	}
+
+	content, err := assetsFS.ReadFile("assets/rclone@.service")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded unit: %w", err)
+	}
+	unit := renderUnit(content, installPaths{Rclone: rclone, Manager: packagedManagerPath, ExcludeList: excludeList})
+	args := parseExecStart(string(unit))
+	for i, arg := range args {
+		args[i] = expandSpecifiers(arg, name)
+	}
+	return args, nil
+}
+
+// ensureUserExcludeList writes the embedded exclude list if the package didn't install one.
+func ensureUserExcludeList() error {
+	if _, err := os.Stat(excludeListPath); err == nil {
+		return nil
+	}
+	p := getUserExcludeListPath()
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+	content, err := assetsFS.ReadFile("assets/file-exclude-list.txt")
+	if err != nil {
+		return fmt.Errorf("failed to read embedded exclude list: %w", err)
+	}
+	if err := ensureFolderExists(path.Dir(p)); err != nil {
+		return err
+	}
+	return os.WriteFile(p, content, 0o644)
+}
+
+// isMountPoint checks the mount table, a hung mount would block a stat of the path.
+func isMountPoint(mountPath string) bool {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return false
+	}
+	defer f.Close() // nolint:errcheck
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 4 && fields[4] == mountPath {
+			return true
+		}
+	}
+	return false
+}
+
+func supervisedDriveName(unitName string) (string, bool) {
+	if !strings.HasPrefix(unitName, "rclone@") || !strings.HasSuffix(unitName, ".service") {
+		return "", false
+	}
+	return unitNameToDriveName(unitName), true
+}
+
+func (s *supervisor) setActiveState(m *supervisedMount, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m.activeState = state
+}
+
+// startRclone starts rclone and feeds its log into the error pipeline.
+// exited is closed once the process is gone.
+func (s *supervisor) startRclone(name string) (*exec.Cmd, <-chan struct{}, error) {
+	args, err := s.command(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	os.Remove(getDriveRCSocketPath(name)) // nolint:errcheck
+
+	cmd := exec.Command(args[0], args[1:]...)
+	// don't leave orphaned mounts behind if the supervisor gets killed
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get stderr: %w", err)
+	}
+	cmd.Stdout = cmd.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to start rclone: %w", err)
+	}
+
+	// the journald reader would block on file selectors, so entries are handled one after another
+	entries := make(chan LogEntry, 64)
+	go func() {
+		for entry := range entries {
+			handleLogEntry(entry, name)
+		}
+	}()
+
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		defer close(entries)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Printf("%s: %s", name, scanner.Text())
+			select {
+			case entries <- LogEntry{Message: scanner.Text(), Unit: driveNameToUnitName(name)}:
+			default:
+				log.Printf("%s: dropping log entry, error handling is too slow", name)
+			}
+		}
+		if err := cmd.Wait(); err != nil {
+			log.Printf("rclone of %q exited: %v", name, err)
+		}
+	}()
+	return cmd, exited, nil
+}
+
+// terminate asks rclone to unmount and kills it if it doesn't.
+func terminate(name string, cmd *exec.Cmd, exited <-chan struct{}) {
+	cmd.Process.Signal(syscall.SIGTERM) // nolint:errcheck
+	select {
+	case <-exited:
+	case <-time.After(supervisorStopTimeout):
+		log.Printf("rclone of %q didn't stop in time, killing it", name)
+		cmd.Process.Kill() // nolint:errcheck
+		<-exited
+	}
+	forceUmount(context.Background(), name)
+}
+
+// reportStart sends the result of the start job to the caller of StartUnit.
+// Only the first result is reported, it returns false if it was reported already.
+func (s *supervisor) reportStart(m *supervisedMount, result string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.started == nil {
+		return false
+	}
+	m.started <- result
+	m.started = nil
+	return true
+}
+
+// runMount keeps the mount of a drive running until it gets stopped.
+func (s *supervisor) runMount(m *supervisedMount) {
+	defer close(m.done)
+	backoff := supervisorMinBackoff
+	for {
+		s.setActiveState(m, "activating")
+		startedAt := time.Now()
+		result := s.runOnce(m)
+		if result == "stopped" {
+			s.setActiveState(m, "inactive")
+			s.reportStart(m, "canceled")
+			return
+		}
+		s.setActiveState(m, "failed")
+		// a mount that fails right away isn't restarted, the caller of StartUnit gets the error instead
+		if s.reportStart(m, result) {
+			return
+		}
+
+		if time.Since(startedAt) > supervisorStableAfter {
+			backoff = supervisorMinBackoff
+		}
+		log.Printf("Mount %q stopped unexpectedly, restarting in %s", m.name, backoff)
+		select {
+		case <-m.stop:
+			s.setActiveState(m, "inactive")
+			return
+		case <-time.After(backoff):
+		}
+		s.mu.Lock()
+		m.restarts++
+		s.mu.Unlock()
+		backoff = min(backoff*2, supervisorMaxBackoff)
+	}
+}
+
+// runOnce runs rclone until it exits and returns the result like systemd would report it for a start job.
+// "done" means the mount was up and exited later on, "stopped" that it was stopped on request.
+func (s *supervisor) runOnce(m *supervisedMount) string {
+	cmd, exited, err := s.startRclone(m.name)
+	if err != nil {
+		log.Printf("Failed to mount %q: %v", m.name, err)
+		return "failed"
+	}
+
+	mountPath := getDriveDataPath(m.name)
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(supervisorStartTimeout)
+	for !s.isMounted(mountPath) {
+		select {
+		case <-exited:
+			return "failed"
+		case <-m.stop:
+			terminate(m.name, cmd, exited)
+			return "stopped"
+		case <-timeout:
+			terminate(m.name, cmd, exited)
+			return "timeout"
+		case <-ticker.C:
+		}
+	}
+	s.setActiveState(m, "active")
+	s.reportStart(m, "done")
+
+	select {
+	case <-exited:
+		forceUmount(context.Background(), m.name)
+		return "done"
+	case <-m.stop:
+		terminate(m.name, cmd, exited)
+		return "stopped"
+	}
+}
+
+func (s *supervisor) Reload(context.Context) error {
+	return nil
+}
+
+func (s *supervisor) Close() {}
+
+func (s *supervisor) StartUnit(ctx context.Context, unitName string) error {
+	if unitName == daemonUnitName {
+		return nil
+	}
+	name, ok := supervisedDriveName(unitName)
+	if !ok {
+		return fmt.Errorf("failed to start service %q: not supported by the supervisor", unitName)
+	}
+
+	s.mu.Lock()
+	m, ok := s.mounts[name]
+	if ok {
+		select {
+		case <-m.done:
+		default:
+			// already running or waiting for a restart
+			s.mu.Unlock()
+			return nil
+		}
+	}
+	started := make(chan string, 1)
+	next := &supervisedMount{
+		name:        name,
+		activeState: "activating",
+		started:     started,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if m != nil {
+		next.restarts = m.restarts
+	}
+	s.mounts[name] = next
+	s.mu.Unlock()
+
+	go s.runMount(next)
+	return waitForJob(ctx, "start", unitName, started)
+}
+
+func (s *supervisor) StopUnit(ctx context.Context, unitName string) error {
+	if unitName == daemonUnitName {
+		return nil
+	}
+	name, ok := supervisedDriveName(unitName)
+	if !ok {
+		return fmt.Errorf("failed to stop service %q: not supported by the supervisor", unitName)
+	}
+	s.mu.Lock()
+	m, ok := s.mounts[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	m.stopOnce.Do(func() { close(m.stop) })
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to stop service %q: %w", unitName, ctx.Err())
+	}
+}
+
+func (s *supervisor) RestartUnit(ctx context.Context, unitName string) error {
+	if err := s.StopUnit(ctx, unitName); err != nil {
+		return err
+	}
+	return s.StartUnit(ctx, unitName)
+}
+
+// the enabled drives are stored in the state, the supervisor mounts them on startup
+func (s *supervisor) setEnabled(unitName string, enabled bool) error {
+	name, ok := supervisedDriveName(unitName)
+	if !ok {
+		return fmt.Errorf("unit %q not supported by the supervisor", unitName)
+	}
+	return updateState(func(st *managerState) error {
+		st.SupervisedDrives = slices.DeleteFunc(st.SupervisedDrives, func(n string) bool { return n == name })
+		if enabled {
+			st.SupervisedDrives = append(st.SupervisedDrives, name)
+		}
+		return nil
+	})
+}
+
+func (s *supervisor) EnableUnit(_ context.Context, unitName string) error {
+	if unitName == daemonUnitName {
+		return nil
+	}
+	if err := s.setEnabled(unitName, true); err != nil {
+		return fmt.Errorf("failed to enable service %q: %w", unitName, err)
+	}
+	return nil
+}
+
+func (s *supervisor) DisableUnit(_ context.Context, unitName string) error {
+	if unitName == daemonUnitName {
+		return nil
+	}
+	if err := s.setEnabled(unitName, false); err != nil {
+		return fmt.Errorf("failed to disable service %q: %w", unitName, err)
+	}
+	return nil
+}
+
+func (s *supervisor) UnitFileState(_ context.Context, unitName string) (string, error) {
+	if unitName == daemonUnitName {
+		return "static", nil
+	}
+	name, ok := supervisedDriveName(unitName)
+	if !ok {
+		return "", fmt.Errorf("failed to get unit file state of %q: not supported by the supervisor", unitName)
+	}
+	state, err := loadState()
+	if err != nil {
+		return "", err
+	}
+	if slices.Contains(state.SupervisedDrives, name) {
+		return "enabled", nil
+	}
+	return "disabled", nil
+}
+
+func (s *supervisor) Restarts(_ context.Context, unitName string) (uint32, error) {
+	name, _ := supervisedDriveName(unitName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.mounts[name]; ok {
+		return m.restarts, nil
+	}
+	return 0, nil
+}
+
+func (s *supervisor) ListUnits(_ context.Context, unitNames []string) ([]dbus.UnitStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]dbus.UnitStatus, len(unitNames))
+	for i, unitName := range unitNames {
+		status := dbus.UnitStatus{Name: unitName, LoadState: "loaded", ActiveState: "inactive"}
+		name, ok := supervisedDriveName(unitName)
+		switch {
+		case unitName == daemonUnitName:
+			status.ActiveState = "active"
+		case !ok:
+			status.LoadState = "not-found"
+		default:
+			if m, ok := s.mounts[name]; ok {
+				status.ActiveState = m.activeState
+			}
+		}
+		statuses[i] = status
+	}
+	return statuses, nil
+}
+
+// stopAll stops all mounts, used when the supervisor exits.
+func (s *supervisor) stopAll(ctx context.Context) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.mounts))
+	for name := range s.mounts {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.StopUnit(ctx, driveNameToUnitName(name)); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// supervisorRequest is the body of every request to the supervisor socket.
+type supervisorRequest struct {
+	Unit  string   `json:"unit,omitempty"`
+	Units []string `json:"units,omitempty"`
+}
+
+// supervisorHandler exposes a serviceManager over HTTP, supervisorClient is the other end.
+func supervisorHandler(sm serviceManager) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{method}", func(w http.ResponseWriter, r *http.Request) {
+		var req supervisorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeSupervisorError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ctx := r.Context()
+		var out any = map[string]any{}
+		var err error
+		switch r.PathValue("method") {
+		case "reload":
+			err = sm.Reload(ctx)
+		case "start":
+			err = sm.StartUnit(ctx, req.Unit)
+		case "stop":
+			err = sm.StopUnit(ctx, req.Unit)
+		case "restart":
+			err = sm.RestartUnit(ctx, req.Unit)
+		case "enable":
+			err = sm.EnableUnit(ctx, req.Unit)
+		case "disable":
+			err = sm.DisableUnit(ctx, req.Unit)
+		case "unit-file-state":
+			var state string
+			state, err = sm.UnitFileState(ctx, req.Unit)
+			out = map[string]string{"state": state}
+		case "restarts":
+			var n uint32
+			n, err = sm.Restarts(ctx, req.Unit)
+			out = map[string]uint32{"restarts": n}
+		case "list":
+			out, err = sm.ListUnits(ctx, req.Units)
+		default:
+			writeSupervisorError(w, http.StatusNotFound, fmt.Errorf("unknown method %q", r.PathValue("method")))
+			return
+		}
+		if err != nil {
+			writeSupervisorError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out) // nolint:errcheck
+	})
+	return mux
+}
+
+func writeSupervisorError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}) // nolint:errcheck
+}
+
+// supervisorClient talks to a running 'adfinis-rclone-mgr supervise'.
+type supervisorClient struct {
+	socketPath string
+}
+
+func (c *supervisorClient) call(ctx context.Context, method string, in, out any) error {
+	return unixSocketCall(ctx, c.socketPath, method, in, out)
+}
+
+func (c *supervisorClient) Close() {}
+
+func (c *supervisorClient) Reload(ctx context.Context) error {
+	return c.call(ctx, "reload", nil, nil)
+}
+
+func (c *supervisorClient) StartUnit(ctx context.Context, unitName string) error {
+	return c.call(ctx, "start", supervisorRequest{Unit: unitName}, nil)
+}
+
+func (c *supervisorClient) StopUnit(ctx context.Context, unitName string) error {
+	return c.call(ctx, "stop", supervisorRequest{Unit: unitName}, nil)
+}
+
+func (c *supervisorClient) RestartUnit(ctx context.Context, unitName string) error {
+	return c.call(ctx, "restart", supervisorRequest{Unit: unitName}, nil)
+}
+
+func (c *supervisorClient) EnableUnit(ctx context.Context, unitName string) error {
+	return c.call(ctx, "enable", supervisorRequest{Unit: unitName}, nil)
+}
+
+func (c *supervisorClient) DisableUnit(ctx context.Context, unitName string) error {
+	return c.call(ctx, "disable", supervisorRequest{Unit: unitName}, nil)
+}
+
+func (c *supervisorClient) UnitFileState(ctx context.Context, unitName string) (string, error) {
+	var out struct {
+		State string `json:"state"`
+	}
+	err := c.call(ctx, "unit-file-state", supervisorRequest{Unit: unitName}, &out)
+	return out.State, err
+}
+
+func (c *supervisorClient) Restarts(ctx context.Context, unitName string) (uint32, error) {
+	var out struct {
+		Restarts uint32 `json:"restarts"`
+	}
+	err := c.call(ctx, "restarts", supervisorRequest{Unit: unitName}, &out)
+	return out.Restarts, err
+}
+
+func (c *supervisorClient) ListUnits(ctx context.Context, unitNames []string) ([]dbus.UnitStatus, error) {
+	var out []dbus.UnitStatus
+	err := c.call(ctx, "list", supervisorRequest{Units: unitNames}, &out)
+	return out, err
+}
+
+// connectSupervisor returns a client if a supervisor is listening on the socket.
+func connectSupervisor(ctx context.Context, socketPath string) (*supervisorClient, error) {
+	c := &supervisorClient{socketPath: socketPath}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := c.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// listenSupervisor listens on the supervisor socket, removing a stale one left behind by a crash.
+func listenSupervisor(ctx context.Context, socketPath string) (net.Listener, error) {
+	if _, err := connectSupervisor(ctx, socketPath); err == nil {
+		return nil, fmt.Errorf("another supervisor is already listening on %s", socketPath)
+	}
+	os.Remove(socketPath) // nolint:errcheck
+	if err := ensureFolderExists(path.Dir(socketPath)); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	// only the user may control the mounts
+	if err := os.Chmod(socketPath, 0o600); err != nil {
+		l.Close() // nolint:errcheck
+		return nil, err
+	}
+	return l, nil
+}
+
+func supervise(cmd *cobra.Command, _ []string) {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := ensureUserExcludeList(); err != nil {
+		log.Fatalln("Failed to write exclude list:", err)
+	}
+	socketPath := getSupervisorSocketPath()
+	l, err := listenSupervisor(ctx, socketPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer os.Remove(socketPath) // nolint:errcheck
+
+	s := newSupervisor()
+	srv := &http.Server{Handler: supervisorHandler(s), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		log.Printf("Supervisor listening on %s", socketPath)
+		if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Supervisor server error: %v", err)
+		}
+	}()
+
+	// the supervisor takes the place of the daemon unit as well, that includes mounting the enabled drives
+	d := &mgrDaemon{sm: s}
+	d.run(ctx)
+
+	ctxShutdown, cancelShutdown := context.WithTimeout(context.Background(), supervisorStopTimeout+5*time.Second)
+	defer cancelShutdown()
+	srv.Shutdown(ctxShutdown) // nolint:errcheck
+	s.stopAll(ctxShutdown)
+	log.Println("Supervisor stopped")
+}
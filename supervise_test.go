@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRcloneMountCommandMatchesUnit(t *testing.T) {
+	content, err := assetsFS.ReadFile("assets/rclone@.service")
+	assert.NoError(t, err)
+
+	args := parseExecStart(string(content))
+	for i, arg := range args {
+		args[i] = expandSpecifiers(arg, "My_Drive")
+	}
+	assert.Equal(t, []string{
+		"/usr/bin/rclone", "mount",
+		"--cache-dir", xdg.Home + "/.cache/google/My_Drive",
+		"--vfs-cache-mode", "writes",
+		"--vfs-cache-max-size", "10G",
+		"--exclude-from", excludeListPath,
+		"--rc",
+		"--rc-addr", "unix://" + xdg.RuntimeDir + "/rclone@My_Drive.sock",
+		"--rc-no-auth",
+		"My_Drive:", xdg.Home + "/google/My_Drive",
+	}, args)
+}
+
+func newTestSupervisor(command ...string) *supervisor {
+	s := newSupervisor()
+	s.command = func(string) ([]string, error) { return command, nil }
+	s.isMounted = func(string) bool { return true }
+	return s
+}
+
+func TestSupervisorLifecycle(t *testing.T) {
+	useTempDirs(t)
+	ctx := context.Background()
+	s := newTestSupervisor("sleep", "60")
+
+	assert.Empty(t, mountDrives(ctx, s, []string{"My_Drive"}))
+	statuses, err := statusServices(ctx, s, []string{"My_Drive", "Other"})
+	assert.NoError(t, err)
+	assert.Equal(t, "active", statuses[0].ActiveState)
+	assert.Equal(t, "inactive", statuses[1].ActiveState)
+
+	assert.NoError(t, enableService(ctx, s, "My_Drive"))
+	enabled, err := isServiceEnabled(ctx, s, "My_Drive")
+	assert.NoError(t, err)
+	assert.True(t, enabled)
+
+	assert.Empty(t, umountDrives(ctx, s, []string{"My_Drive"}, false))
+	statuses, err = statusServices(ctx, s, []string{"My_Drive"})
+	assert.NoError(t, err)
+	assert.Equal(t, "inactive", statuses[0].ActiveState)
+}
+
+func TestSupervisorFailedStart(t *testing.T) {
+	useTempDirs(t)
+	s := newTestSupervisor("false")
+	s.isMounted = func(string) bool { return false }
+
+	err := s.StartUnit(context.Background(), "rclone@My_Drive.service")
+	assert.EqualError(t, err, `failed to start service "rclone@My_Drive.service": failed`)
+	statuses, err := s.ListUnits(context.Background(), []string{"rclone@My_Drive.service"})
+	assert.NoError(t, err)
+	assert.Equal(t, "failed", statuses[0].ActiveState)
+}
+
+func TestSupervisorRestartsCrashedMount(t *testing.T) {
+	useTempDirs(t)
+	ctx := context.Background()
+	s := newTestSupervisor("sh", "-c", "sleep 0.1")
+
+	assert.NoError(t, s.StartUnit(ctx, "rclone@My_Drive.service"))
+	assert.Eventually(t, func() bool {
+		n, _ := s.Restarts(ctx, "rclone@My_Drive.service")
+		return n > 0
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.NoError(t, s.StopUnit(ctx, "rclone@My_Drive.service"))
+}
+
+func TestSupervisorSocket(t *testing.T) {
+	useTempDirs(t)
+	ctx := context.Background()
+	socketPath := filepath.Join(xdg.RuntimeDir, "supervise.sock")
+
+	sm := newFakeServiceManager()
+	sm.setJobResult("start", "rclone@Slow.service", "timeout")
+	l, err := listenSupervisor(ctx, socketPath)
+	assert.NoError(t, err)
+	srv := &http.Server{Handler: supervisorHandler(sm)}
+	go srv.Serve(l)   // nolint:errcheck
+	defer srv.Close() // nolint:errcheck
+
+	// only one supervisor at a time
+	_, err = listenSupervisor(ctx, socketPath)
+	assert.Error(t, err)
+
+	c, err := connectSupervisor(ctx, socketPath)
+	assert.NoError(t, err)
+	assert.NoError(t, c.StartUnit(ctx, "rclone@My_Drive.service"))
+	assert.NoError(t, c.EnableUnit(ctx, "rclone@My_Drive.service"))
+	err = c.StartUnit(ctx, "rclone@Slow.service")
+	assert.EqualError(t, err, `failed to start service "rclone@Slow.service": timeout`)
+
+	statuses, err := c.ListUnits(ctx, []string{"rclone@My_Drive.service", "rclone@Slow.service"})
+	assert.NoError(t, err)
+	assert.Equal(t, "active", statuses[0].ActiveState)
+	assert.Equal(t, "failed", statuses[1].ActiveState)
+	state, err := c.UnitFileState(ctx, "rclone@My_Drive.service")
+	assert.NoError(t, err)
+	assert.Equal(t, "enabled", state)
+}
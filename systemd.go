@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"os"
 
@@ -10,6 +9,15 @@ import (
 	"github.com/coreos/go-systemd/v22/dbus"
 )
 
+const (
+	// daemonUnitName is the unit running 'adfinis-rclone-mgr daemon'
+	daemonUnitName = "adfinis-rclone-mgr.service"
+	// automountTargetName wants the enabled drives, the daemon starts them once the network is up
+	automountTargetName = "adfinis-rclone-mgr-automount.target"
+	// discoverTimerName runs 'adfinis-rclone-mgr discover --notify' regularly, it's only enabled by the user
+	discoverTimerName = "adfinis-rclone-mgr-discover.timer"
+)
+
 func removeDriveCache(name string) error {
 	cachePath := getDriveCachePath(name)
 	if _, err := os.Stat(cachePath); err != nil {
@@ -25,20 +33,27 @@ func removeDriveCache(name string) error {
 }
 
 func handleSystemdServices(ctx context.Context, drives []models.Drive) error {
-	conn, err := dbus.NewUserConnectionContext(ctx)
+	sm, err := newServiceManager(ctx)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer sm.Close()
+	return manageDriveServices(ctx, sm, drives)
+}
 
+// manageDriveServices starts and enables or stops and disables the mounts of the drives.
+func manageDriveServices(ctx context.Context, sm serviceManager, drives []models.Drive) error {
 	// make sure systmed know about the rclone mount service
-	if err := conn.ReloadContext(ctx); err != nil {
-		return fmt.Errorf("failed to reload systemd: %w", err)
+	if err := sm.Reload(ctx); err != nil {
+		return err
 	}
 
 	var errs []error
 	for _, drive := range drives {
-		name := sanitizeDriveName(drive.Name)
+		name := driveMountName(drive)
+		if !drive.Enabled {
+			name = driveRemoteName(drive)
+		}
 		if err := ensureFolderExists(getDriveDataPath(name)); err != nil {
 			return err
 		}
@@ -47,94 +62,97 @@ func handleSystemdServices(ctx context.Context, drives []models.Drive) error {
 		}
 
 		if drive.Enabled {
-			if err := startService(ctx, conn, name); err != nil {
+			if err := startService(ctx, sm, name); err != nil {
 				errs = append(errs, err)
 				continue
 			}
 			if drive.AutoMount {
-				if err := enableService(ctx, conn, name); err != nil {
+				if err := enableService(ctx, sm, name); err != nil {
 					errs = append(errs, err)
 					continue
 				}
+			} else if err := disableService(ctx, sm, name); err != nil {
+				errs = append(errs, err)
+				continue
 			}
 
 		} else {
-			if err := stopService(ctx, conn, name); err != nil {
+			if err := stopService(ctx, sm, name); err != nil {
 				errs = append(errs, err)
 				continue
 			}
-			if err := disableService(ctx, conn, name); err != nil {
+			if err := disableService(ctx, sm, name); err != nil {
 				errs = append(errs, err)
 				continue
 			}
 			if err := removeDriveCache(name); err != nil {
 				continue
 			}
+			// the unit needs the mountpoint until it's stopped
+			if err := removeMountEnv(name); err != nil {
+				errs = append(errs, err)
+				continue
+			}
 		}
 	}
-	// pretty error string
-	if len(errs) > 0 {
-		errStr := "Error while handling systemd services:\n"
-		for _, err := range errs {
-			errStr += fmt.Sprintf("- %s\n", err.Error())
-		}
-		return errors.New(errStr)
+
+	// the daemon applies bandwidth schedules to the mounts
+	if err := sm.EnableUnit(ctx, daemonUnitName); err != nil {
+		errs = append(errs, err)
+	} else if err := sm.StartUnit(ctx, daemonUnitName); err != nil {
+		errs = append(errs, err)
 	}
-	return nil
+	return joinErrors("Error while handling systemd services", errs)
 }
 
-func enableService(ctx context.Context, conn *dbus.Conn, name string) error {
-	serviceName := fmt.Sprintf("rclone@%s.service", name)
-	_, _, err := conn.EnableUnitFilesContext(ctx, []string{serviceName}, false, true)
-	if err != nil {
-		return fmt.Errorf("failed to enable service %q: %w", serviceName, err)
-	}
-	return nil
+func enableService(ctx context.Context, sm serviceManager, name string) error {
+	return sm.EnableUnit(ctx, driveNameToUnitName(name))
 }
 
-func startService(ctx context.Context, conn *dbus.Conn, name string) error {
-	serviceName := fmt.Sprintf("rclone@%s.service", name)
-	ch := make(chan string)
-	_, err := conn.StartUnitContext(ctx, serviceName, "replace", ch)
-	if err != nil {
-		return fmt.Errorf("failed to start service %q: %w", serviceName, err)
-	}
-	result := <-ch
+func startService(ctx context.Context, sm serviceManager, name string) error {
+	return sm.StartUnit(ctx, driveNameToUnitName(name))
+}
 
-	if result != "done" {
-		return fmt.Errorf("failed to start service %q: %s", serviceName, result)
-	}
-	return nil
+func stopService(ctx context.Context, sm serviceManager, name string) error {
+	return sm.StopUnit(ctx, driveNameToUnitName(name))
 }
 
-func stopService(ctx context.Context, conn *dbus.Conn, name string) error {
-	serviceName := fmt.Sprintf("rclone@%s.service", name)
-	ch := make(chan string)
-	_, err := conn.StopUnitContext(ctx, serviceName, "replace", ch)
-	if err != nil {
-		return fmt.Errorf("failed to stop service %q: %w", serviceName, err)
-	}
-	result := <-ch
+func restartService(ctx context.Context, sm serviceManager, name string) error {
+	return sm.RestartUnit(ctx, driveNameToUnitName(name))
+}
 
-	if result != "done" {
-		return fmt.Errorf("failed to stop service %q: %s", serviceName, result)
-	}
-	return nil
+func disableService(ctx context.Context, sm serviceManager, name string) error {
+	return sm.DisableUnit(ctx, driveNameToUnitName(name))
 }
 
-func disableService(ctx context.Context, conn *dbus.Conn, name string) error {
-	serviceName := fmt.Sprintf("rclone@%s.service", name)
-	_, err := conn.DisableUnitFilesContext(ctx, []string{serviceName}, false)
+// isServiceEnabled reports whether the drive is mounted automatically.
+func isServiceEnabled(ctx context.Context, sm serviceManager, name string) (bool, error) {
+	state, err := sm.UnitFileState(ctx, driveNameToUnitName(name))
 	if err != nil {
-		return fmt.Errorf("failed to disable service %q: %w", serviceName, err)
+		return false, err
 	}
-	return nil
+	return state == "enabled", nil
 }
 
-func statusServices(ctx context.Context, conn *dbus.Conn, names []string) ([]dbus.UnitStatus, error) {
+func statusServices(ctx context.Context, sm serviceManager, names []string) ([]dbus.UnitStatus, error) {
 	unitNames := make([]string, len(names))
 	for i, n := range names {
-		unitNames[i] = fmt.Sprintf("rclone@%s.service", n)
+		unitNames[i] = driveNameToUnitName(n)
+	}
+	return sm.ListUnits(ctx, unitNames)
+}
+
+// activeDrives returns the names of all drives that are currently mounted.
+func activeDrives(ctx context.Context, sm serviceManager) ([]string, error) {
+	statuses, err := statusServices(ctx, sm, getRemotes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service status: %w", err)
+	}
+	var drives []string
+	for _, status := range statuses {
+		if status.ActiveState == "active" {
+			drives = append(drives, unitNameToDriveName(status.Name))
+		}
 	}
-	return conn.ListUnitsByNamesContext(ctx, unitNames)
+	return drives, nil
 }
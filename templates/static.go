@@ -0,0 +1,13 @@
+package templates
+
+import "embed"
+
+// The stylesheet is built from the classes used in the templates, so the pages work offline.
+// static/app.css is checked in, so building and releasing don't need Node.
+// Regenerate it after changing classes instead of editing it by hand, npx needs network access to fetch tailwind.
+//go:generate npx --yes tailwindcss@3.4.17 -c tailwind.config.js -i tailwind.css -o static/app.css --minify
+
+// Static holds the stylesheet and scripts of the pages, served under /static.
+//
+//go:embed static
+var Static embed.FS
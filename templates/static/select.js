@@ -0,0 +1,257 @@
+// Live validation of the local names on the drive selection page, the server checks them again.
+// The rules match validateLocalName and validateMountNames in localname.go.
+// The page also has search, sorting and grouping for long lists of drives and a folder browser to mount single folders.
+(function () {
+  "use strict";
+
+  const pattern = /^[A-Za-z0-9][A-Za-z0-9._]*$/;
+  const maxLength = 64;
+
+  function validate(form) {
+    const reserved = JSON.parse(form.dataset.reserved || "[]");
+    // the drives of a profile are named with its prefix
+    const prefix = form.dataset.prefix || "";
+    const removed = Array.from(form.querySelectorAll('input[name="remove"]:checked'), (el) => el.value);
+    const rows = Array.from(form.querySelectorAll("[data-drive]"), (row) => {
+      const input = row.querySelector("[data-local-name]");
+      return {
+        input: input,
+        error: row.querySelector("[data-local-name-error]"),
+        enabled: row.querySelector('input[name="drive"]').checked,
+        name: prefix + (input.value.trim() || input.placeholder),
+      };
+    });
+
+    const byName = new Map();
+    rows.forEach((row) => {
+      byName.set(row.name, (byName.get(row.name) || []).concat(row));
+    });
+
+    rows.forEach((row) => {
+      let message = "";
+      const local = row.input.value.trim();
+      const group = byName.get(row.name);
+      if (local !== "" && local.length > maxLength) {
+        message = `At most ${maxLength} characters`;
+      } else if (local !== "" && !pattern.test(local)) {
+        message = "Only letters, digits, '.' and '_', starting with a letter or digit";
+      } else if (group.length > 1 && group.some((other) => other.enabled)) {
+        message = `Another drive is mounted as ${row.name}`;
+      } else if (row.enabled && reserved.includes(row.name) && !removed.includes(row.name)) {
+        message = `${row.name} is already used by another remote`;
+      }
+      row.input.setCustomValidity(message);
+      row.error.textContent = message;
+      row.error.hidden = message === "";
+    });
+  }
+
+  // prefixOf is the part of a drive name before the first separator, e.g. "ACME" of "ACME - Sales".
+  function prefixOf(name) {
+    return name.trim().split(/[\s\-–:|/_.]+/)[0];
+  }
+
+  // the rows are flex boxes, the hidden attribute wouldn't hide them
+  const isHidden = (el) => el.classList.contains("hidden");
+
+  // arrange filters, sorts and groups the drive rows, filtered rows are still sent with the form.
+  function arrange(form) {
+    const container = form.querySelector("[data-drives]");
+    const search = form.querySelector("[data-drive-search]").value.trim().toLowerCase();
+    const sort = form.querySelector("[data-drive-sort]").value;
+    const group = form.querySelector("[data-drive-group]").checked;
+
+    const rows = Array.from(container.querySelectorAll("[data-drive]"));
+    const enabled = (row) => row.querySelector('input[name="drive"]').checked;
+    rows.sort((a, b) => {
+      if (sort === "enabled" && enabled(a) !== enabled(b)) {
+        return enabled(a) ? -1 : 1;
+      }
+      const order = a.dataset.name.localeCompare(b.dataset.name, undefined, { sensitivity: "base", numeric: true });
+      return sort === "name-desc" ? -order : order;
+    });
+    rows.forEach((row) => {
+      const input = row.querySelector("[data-local-name]");
+      const text = [row.dataset.name, input.value, input.placeholder].join(" ").toLowerCase();
+      row.classList.toggle("hidden", search !== "" && !text.includes(search));
+    });
+
+    container.querySelectorAll("[data-group-header]").forEach((el) => el.remove());
+    if (!group) {
+      container.append(...rows);
+    } else {
+      // prefixes shared by a single drive aren't worth a group of their own
+      const groups = new Map();
+      rows.forEach((row) => {
+        const prefix = prefixOf(row.dataset.name).toLowerCase();
+        groups.set(prefix, (groups.get(prefix) || []).concat(row));
+      });
+      const other = [];
+      groups.forEach((members) => {
+        if (members.length < 2) {
+          other.push(...members);
+          return;
+        }
+        container.append(groupHeader(prefixOf(members[0].dataset.name), members), ...members);
+      });
+      if (other.length > 0) {
+        container.append(groupHeader("Other", other), ...other);
+      }
+    }
+    updateCount(form);
+  }
+
+  function groupHeader(label, members) {
+    const header = document.createElement("h4");
+    header.className = "text-sm font-semibold text-[#2e4b98]";
+    header.dataset.groupHeader = "";
+    header.textContent = `${label} (${members.length})`;
+    header.classList.toggle("hidden", members.every(isHidden));
+    return header;
+  }
+
+  function updateCount(form) {
+    const rows = Array.from(form.querySelectorAll("[data-drives] [data-drive]"));
+    const picked = rows.filter((row) => row.querySelector('input[name="drive"]').checked).length;
+    const shown = rows.filter((row) => !isHidden(row)).length;
+    let text = `${picked} of ${rows.length} enabled`;
+    if (shown !== rows.length) {
+      text += `, ${shown} shown`;
+    }
+    form.querySelector("[data-drive-count]").textContent = text;
+  }
+
+  // select enables all drives, none of them, or only the ones matching the search.
+  function select(form, which) {
+    form.querySelectorAll("[data-drives] [data-drive]").forEach((row) => {
+      row.querySelector('input[name="drive"]').checked = which === "all" || (which === "filtered" && !isHidden(row));
+    });
+    validate(form);
+    updateCount(form);
+  }
+
+  function setupDriveTools(form) {
+    const search = form.querySelector("[data-drive-search]");
+    if (!search) {
+      return;
+    }
+    search.addEventListener("input", () => arrange(form));
+    // Enter would send the form
+    search.addEventListener("keydown", (event) => {
+      if (event.key === "Enter") {
+        event.preventDefault();
+      }
+    });
+    form.querySelector("[data-drive-sort]").addEventListener("change", () => arrange(form));
+    form.querySelector("[data-drive-group]").addEventListener("change", () => arrange(form));
+    form.querySelectorAll("[data-select]").forEach((button) => {
+      button.addEventListener("click", () => select(form, button.dataset.select));
+    });
+    form.addEventListener("change", (event) => {
+      if (event.target.name === "drive") {
+        updateCount(form);
+      }
+    });
+    arrange(form);
+  }
+
+  // The folder browser lists the folders of a drive through /folders, picked folders are added as rows of their own.
+  function setupFolderBrowser(form) {
+    const browser = form.querySelector("[data-folder-browser]");
+    if (!browser) {
+      return;
+    }
+    const driveSelect = browser.querySelector("[data-folder-drive]");
+    const pathLine = browser.querySelector("[data-folder-path]");
+    const list = browser.querySelector("[data-folder-list]");
+    const addButton = browser.querySelector("[data-folder-add]");
+    // the folders from the top of the drive to the current one
+    let path = [];
+
+    function entryButton(label, onClick) {
+      const item = document.createElement("li");
+      const button = document.createElement("button");
+      button.type = "button";
+      button.className = "w-full px-2 py-1 text-left text-sm rounded hover:bg-[#e6ebf5]";
+      button.textContent = label;
+      button.addEventListener("click", onClick);
+      item.appendChild(button);
+      return item;
+    }
+
+    async function load() {
+      const drive = driveSelect.options[driveSelect.selectedIndex];
+      const current = path[path.length - 1];
+      pathLine.textContent = [drive.text].concat(path.map((f) => f.name)).join(" / ");
+      addButton.disabled = !current;
+      list.replaceChildren();
+      const params = new URLSearchParams({ drive: drive.value, parent: current ? current.id : "" });
+      let folders;
+      try {
+        const response = await fetch(`/folders?${params}`, { credentials: "same-origin" });
+        if (!response.ok) {
+          throw new Error(await response.text());
+        }
+        folders = await response.json();
+      } catch (err) {
+        pathLine.textContent = `Failed to list folders: ${err.message}`;
+        return;
+      }
+      if (path.length > 0) {
+        list.appendChild(entryButton("⬆ ..", () => {
+          path.pop();
+          load();
+        }));
+      }
+      folders.forEach((folder) => {
+        list.appendChild(entryButton(`📁 ${folder.name}`, () => {
+          path.push(folder);
+          load();
+        }));
+      });
+    }
+
+    function addFolder() {
+      const folder = path[path.length - 1];
+      if (!folder) {
+        return;
+      }
+      const exists = Array.from(form.querySelectorAll('input[name="drive"]')).some((el) => el.value === folder.id);
+      if (!exists) {
+        const row = document.getElementById("folder-row").content.firstElementChild.cloneNode(true);
+        row.querySelector('input[name="folder"]').value = folder.id;
+        row.querySelector("[data-folder-name]").textContent = path.map((f) => f.name).join(" / ");
+        const localName = row.querySelector("[data-local-name]");
+        localName.name = `local_name:${folder.id}`;
+        localName.placeholder = folder.mount_name;
+        row.querySelectorAll('input[type="checkbox"]').forEach((el) => {
+          el.value = folder.id;
+        });
+        row.dataset.name = folder.name;
+        form.querySelector("[data-drives]").appendChild(row);
+        validate(form);
+        arrange(form);
+      }
+      pathLine.textContent = exists ? `${folder.name} is in the list already` : `Added ${folder.name}`;
+    }
+
+    driveSelect.addEventListener("change", () => {
+      path = [];
+      load();
+    });
+    addButton.addEventListener("click", addFolder);
+    load();
+  }
+
+  document.addEventListener("DOMContentLoaded", () => {
+    const form = document.getElementById("drive-selection");
+    if (!form) {
+      return;
+    }
+    form.addEventListener("input", () => validate(form));
+    form.addEventListener("change", () => validate(form));
+    validate(form);
+    setupDriveTools(form);
+    setupFolderBrowser(form);
+  });
+})();
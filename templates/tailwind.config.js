@@ -0,0 +1,8 @@
+/** @type {import('tailwindcss').Config} */
+module.exports = {
+  content: ["./*.templ", "./static/*.js"],
+  theme: {
+    extend: {},
+  },
+  plugins: [],
+};
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
 	"strings"
 
+	"github.com/adfinis/adfinis-rclone-mgr/models"
 	"github.com/adrg/xdg"
 )
 
@@ -25,9 +27,32 @@ func sanitizeDriveName(name string) string {
 	name = strings.ReplaceAll(name, "'", "_")
 	name = strings.ReplaceAll(name, "&", "_")
 	name = strings.ReplaceAll(name, "%", "_")
+	// systemd turns '-' in the instance name into '/', see localNamePattern
+	name = strings.ReplaceAll(name, "-", "_")
 	return name
 }
 
+// driveMountName is the name of the remote and the mountpoint of a drive, prefixed for its profile.
+func driveMountName(d models.Drive) string {
+	if d.LocalName != "" {
+		return profilePrefix(d.Profile) + sanitizeDriveName(d.LocalName)
+	}
+	return profilePrefix(d.Profile) + sanitizeDriveName(d.Name)
+}
+
+// driveRemoteName is the remote a drive is configured as right now, or the one it will be added as.
+func driveRemoteName(d models.Drive) string {
+	if d.Remote != "" {
+		return d.Remote
+	}
+	return driveMountName(d)
+}
+
+// needsRename reports whether a configured drive gets a new name, e.g. because it was renamed in Google Drive.
+func needsRename(d models.Drive) bool {
+	return d.Enabled && d.Remote != "" && d.Remote != driveMountName(d)
+}
+
 func ensureFolderExists(path string) error {
 	err := os.MkdirAll(path, os.ModePerm)
 	if err != nil && !os.IsExist(err) {
@@ -46,7 +71,11 @@ func driveNameToUnitName(name string) string {
 	return fmt.Sprintf("rclone@%s.service", name)
 }
 
+// getDriveDataPath returns the mountpoint of a drive, the drives of a profile are in the directory of the profile.
 func getDriveDataPath(name string) string {
+	if dir := readMountEnv(name)["MOUNT_DIR"]; dir != "" {
+		return dir
+	}
 	return path.Join(xdg.Home, "google", name)
 }
 
@@ -54,6 +83,24 @@ func getDriveCachePath(name string) string {
 	return path.Join(xdg.CacheHome, "google", name)
 }
 
+// getDriveRCSocketPath returns the socket the rclone remote control API of a mount listens on.
+// Needs to match the --rc-addr in rclone@.service.
+func getDriveRCSocketPath(name string) string {
+	return path.Join(xdg.RuntimeDir, fmt.Sprintf("rclone@%s.sock", name))
+}
+
 func fileNameToPath(driveName, fileName string) string {
 	return path.Join(getDriveDataPath(driveName), fileName)
 }
+
+// joinErrors builds a pretty error string listing all errors, it returns nil if there are none.
+func joinErrors(title string, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	errStr := title + ":\n"
+	for _, err := range errs {
+		errStr += fmt.Sprintf("- %s\n", err.Error())
+	}
+	return errors.New(errStr)
+}
@@ -5,6 +5,7 @@ import (
 	"path"
 	"testing"
 
+	"github.com/adfinis/adfinis-rclone-mgr/models"
 	"github.com/adrg/xdg"
 	"github.com/coreos/go-systemd/v22/dbus"
 	"github.com/stretchr/testify/assert"
@@ -26,6 +27,7 @@ func TestSanitizeDriveName(t *testing.T) {
 		{"My>Drive", "My_Drive"},
 		{"My|Drive", "My_Drive"},
 		{"My&Drive", "My_Drive"},
+		{"Team-Alpha", "Team_Alpha"},
 	} {
 		result := sanitizeDriveName(test.input)
 		assert.Equal(t, test.expected, result)
@@ -105,3 +107,13 @@ func TestEnsureFolderExists(t *testing.T) {
 	err = ensureFolderExists(path.Join(dir, "test"))
 	assert.NoError(t, err)
 }
+
+func TestDriveMountName(t *testing.T) {
+	assert.Equal(t, "My_Drive", driveMountName(models.Drive{Name: "My Drive"}))
+	assert.Equal(t, "Eng_Docs", driveMountName(models.Drive{Name: "Engineering", LocalName: "Eng Docs"}))
+	// the mount name is a valid local name, even if the drive name isn't
+	assert.Equal(t, "Team_Alpha", driveMountName(models.Drive{Name: "Team-Alpha"}))
+	assert.NoError(t, validateLocalName(driveMountName(models.Drive{Name: "Team-Alpha"})))
+	// a remote set up before gets the new name
+	assert.True(t, needsRename(models.Drive{Name: "Team-Alpha", Enabled: true, Remote: "Team-Alpha"}))
+}
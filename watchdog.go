@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+const (
+	defaultWatchdogInterval = 30 * time.Second
+	defaultWatchdogTimeout  = 5 * time.Second
+	defaultWatchdogFailures = 3
+	// maxInterventions is the number of interventions kept in the state
+	maxInterventions = 50
+)
+
+// withDefaults fills in the defaults for unset values.
+func (c watchdogConfig) withDefaults() watchdogConfig {
+	if c.Interval <= 0 {
+		c.Interval = defaultWatchdogInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultWatchdogTimeout
+	}
+	if c.Failures <= 0 {
+		c.Failures = defaultWatchdogFailures
+	}
+	return c
+}
+
+// mountProbe lists the root of mounts, but never runs more than one check per drive.
+// A hung mount blocks the check forever, without this every interval would leak another goroutine.
+type mountProbe struct {
+	mu       sync.Mutex
+	inflight map[string]chan error
+}
+
+func newMountProbe() *mountProbe {
+	return &mountProbe{inflight: map[string]chan error{}}
+}
+
+func (p *mountProbe) check(ctx context.Context, name, mountPath string, timeout time.Duration) error {
+	p.mu.Lock()
+	ch, ok := p.inflight[name]
+	if !ok {
+		ch = make(chan error, 1)
+		p.inflight[name] = ch
+		go func() {
+			_, err := os.ReadDir(mountPath)
+			ch <- err
+		}()
+	}
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	select {
+	case err := <-ch:
+		p.mu.Lock()
+		delete(p.inflight, name)
+		p.mu.Unlock()
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %s", errMountHung, mountPath)
+	}
+}
+
+type watchdogVerdict int
+
+const (
+	verdictHealthy watchdogVerdict = iota
+	// verdictFailing is a failed check below the threshold
+	verdictFailing
+	// verdictUnhealthy is returned every time the number of failed checks in a row reaches the threshold
+	verdictUnhealthy
+	// verdictRecovered is a successful check after the mount was unhealthy
+	verdictRecovered
+)
+
+// watchdogTracker counts the failed checks of each drive.
+type watchdogTracker struct {
+	threshold int
+	failures  map[string]int
+	unhealthy map[string]bool
+}
+
+func newWatchdogTracker(threshold int) *watchdogTracker {
+	return &watchdogTracker{
+		threshold: threshold,
+		failures:  map[string]int{},
+		unhealthy: map[string]bool{},
+	}
+}
+
+func (t *watchdogTracker) observe(name string, err error) watchdogVerdict {
+	if err == nil {
+		t.failures[name] = 0
+		if t.unhealthy[name] {
+			delete(t.unhealthy, name)
+			return verdictRecovered
+		}
+		return verdictHealthy
+	}
+	t.failures[name]++
+	if t.failures[name] < t.threshold {
+		return verdictFailing
+	}
+	// start counting again, so a failed restart is retried after another round of failed checks
+	t.failures[name] = 0
+	t.unhealthy[name] = true
+	return verdictUnhealthy
+}
+
+// forget drops drives that aren't mounted anymore.
+func (t *watchdogTracker) forget(active []string) {
+	for name := range t.failures {
+		if !lo.Contains(active, name) {
+			delete(t.failures, name)
+			delete(t.unhealthy, name)
+		}
+	}
+}
+
+// recordIntervention keeps track of what the watchdog did, the oldest interventions are dropped.
+func recordIntervention(s *managerState, i watchdogIntervention) {
+	s.Interventions = append(s.Interventions, i)
+	if len(s.Interventions) > maxInterventions {
+		s.Interventions = s.Interventions[len(s.Interventions)-maxInterventions:]
+	}
+}
+
+// setDriveHealth updates the health of a drive in the state and records the intervention.
+func setDriveHealth(name string, unhealthy bool, i watchdogIntervention) error {
+	return updateState(func(s *managerState) error {
+		if unhealthy {
+			if s.Health == nil {
+				s.Health = map[string]driveHealth{}
+			}
+			if !s.Health[name].Unhealthy {
+				s.Health[name] = driveHealth{Unhealthy: true, Since: i.Time}
+			}
+		} else {
+			delete(s.Health, name)
+		}
+		recordIntervention(s, i)
+		return nil
+	})
+}
+
+// clearStaleHealth removes the health of drives that aren't mounted anymore.
+func clearStaleHealth(active []string) error {
+	state, err := loadState()
+	if err != nil {
+		return err
+	}
+	stale := false
+	for name := range state.Health {
+		if !lo.Contains(active, name) {
+			stale = true
+		}
+	}
+	if !stale {
+		return nil
+	}
+	return updateState(func(s *managerState) error {
+		for name := range s.Health {
+			if !lo.Contains(active, name) {
+				delete(s.Health, name)
+			}
+		}
+		return nil
+	})
+}
+
+func (d *mgrDaemon) runWatchdog(ctx context.Context) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	wc := cfg.Watchdog.withDefaults()
+	probe := newMountProbe()
+	tracker := newWatchdogTracker(wc.Failures)
+
+	ticker := time.NewTicker(wc.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		drives, err := activeDrives(ctx, d.sm)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		tracker.forget(drives)
+		if err := clearStaleHealth(drives); err != nil {
+			log.Println(err)
+		}
+
+		var wg sync.WaitGroup
+		results := make([]error, len(drives))
+		for i, name := range drives {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i] = probe.check(ctx, name, getDriveDataPath(name), wc.Timeout)
+			}()
+		}
+		wg.Wait()
+
+		for i, name := range drives {
+			d.handleWatchdogVerdict(ctx, wc, name, tracker.observe(name, results[i]), results[i])
+		}
+	}
+}
+
+func (d *mgrDaemon) handleWatchdogVerdict(ctx context.Context, wc watchdogConfig, name string, verdict watchdogVerdict, checkErr error) {
+	switch verdict {
+	case verdictFailing:
+		log.Printf("Watchdog: check of %q failed: %v", name, checkErr)
+
+	case verdictRecovered:
+		log.Printf("Watchdog: %q recovered", name)
+		if err := setDriveHealth(name, false, watchdogIntervention{Time: time.Now(), Drive: name, Action: "recovered"}); err != nil {
+			log.Println(err)
+		}
+
+	case verdictUnhealthy:
+		log.Printf("Watchdog: %q doesn't respond anymore: %v", name, checkErr)
+		state, err := loadState()
+		if err != nil {
+			// a broken state file shouldn't keep the watchdog from handling the hung mount, treat it as not marked yet
+			log.Println(err)
+			state = &managerState{}
+		}
+		if !state.Health[name].Unhealthy {
+			if err := setDriveHealth(name, true, watchdogIntervention{Time: time.Now(), Drive: name, Action: "marked unhealthy", Error: checkErr.Error()}); err != nil {
+				log.Println(err)
+			}
+			message := fmt.Sprintf("The drive %s doesn't respond anymore, programs accessing it might freeze.", getDriveDataPath(name))
+			if !wc.AutoRestart {
+				message += fmt.Sprintf("\n\nRun 'adfinis-rclone-mgr umount --force %s' and mount it again.", name)
+			}
+			// zenity blocks until the user closes the dialog
+			go func() {
+				if err := sendDesktopNotificationError(fmt.Sprintf("Drive Hangs: %s", name), message); err != nil {
+					log.Println(err)
+				}
+			}()
+		}
+		if !wc.AutoRestart {
+			return
+		}
+
+		i := watchdogIntervention{Time: time.Now(), Drive: name, Action: "restarted"}
+		if err := restartMount(ctx, d.sm, name); err != nil {
+			log.Printf("Watchdog: %v", err)
+			i.Error = err.Error()
+		} else {
+			log.Printf("Watchdog: restarted %q", name)
+		}
+		if err := setDriveHealth(name, true, i); err != nil {
+			log.Println(err)
+		}
+	}
+}
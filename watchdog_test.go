@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchdogTracker(t *testing.T) {
+	tracker := newWatchdogTracker(3)
+	hung := fmt.Errorf("%w: /tmp", errMountHung)
+
+	assert.Equal(t, verdictHealthy, tracker.observe("a", nil))
+	assert.Equal(t, verdictFailing, tracker.observe("a", hung))
+	assert.Equal(t, verdictFailing, tracker.observe("a", hung))
+	// a single success resets the count
+	assert.Equal(t, verdictHealthy, tracker.observe("a", nil))
+
+	assert.Equal(t, verdictFailing, tracker.observe("a", hung))
+	assert.Equal(t, verdictFailing, tracker.observe("a", hung))
+	assert.Equal(t, verdictUnhealthy, tracker.observe("a", hung))
+	// still hanging, try again after another round
+	assert.Equal(t, verdictFailing, tracker.observe("a", hung))
+	assert.Equal(t, verdictFailing, tracker.observe("a", hung))
+	assert.Equal(t, verdictUnhealthy, tracker.observe("a", hung))
+	assert.Equal(t, verdictRecovered, tracker.observe("a", nil))
+	assert.Equal(t, verdictHealthy, tracker.observe("a", nil))
+
+	assert.Equal(t, verdictFailing, tracker.observe("b", hung))
+	tracker.forget([]string{"a"})
+	assert.NotContains(t, tracker.failures, "b")
+}
+
+func TestMountProbe(t *testing.T) {
+	probe := newMountProbe()
+	assert.NoError(t, probe.check(context.Background(), "a", t.TempDir(), time.Second))
+
+	err := probe.check(context.Background(), "b", "/does/not/exist", time.Second)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, errMountHung))
+}
+
+func TestRecordIntervention(t *testing.T) {
+	var s managerState
+	for i := range maxInterventions + 5 {
+		recordIntervention(&s, watchdogIntervention{Drive: fmt.Sprint(i)})
+	}
+	assert.Len(t, s.Interventions, maxInterventions)
+	assert.Equal(t, "5", s.Interventions[0].Drive)
+}
+
+func TestWatchdogMarksUnhealthy(t *testing.T) {
+	useTempDirs(t)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	assert.NoError(t, startService(ctx, sm, "My_Drive"))
+	d := &mgrDaemon{sm: sm}
+	wc := watchdogConfig{AutoRestart: true}.withDefaults()
+
+	d.handleWatchdogVerdict(ctx, wc, "My_Drive", verdictUnhealthy, errMountHung)
+	n, err := sm.Restarts(ctx, "rclone@My_Drive.service")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), n)
+
+	statuses, err := listServiceStatuses(ctx, sm, []string{"My_Drive"})
+	assert.NoError(t, err)
+	assert.Equal(t, "unhealthy", statuses[0].Status)
+
+	d.handleWatchdogVerdict(ctx, wc, "My_Drive", verdictRecovered, nil)
+	state, err := loadState()
+	assert.NoError(t, err)
+	assert.Empty(t, state.Health)
+	actions := make([]string, len(state.Interventions))
+	for i, in := range state.Interventions {
+		actions[i] = in.Action
+	}
+	assert.Equal(t, []string{"marked unhealthy", "restarted", "recovered"}, actions)
+}
+
+func TestWatchdogBrokenState(t *testing.T) {
+	useTempDirs(t)
+	ctx := context.Background()
+	sm := newFakeServiceManager()
+	assert.NoError(t, startService(ctx, sm, "My_Drive"))
+	assert.NoError(t, ensureFolderExists(path.Dir(getStatePath())))
+	assert.NoError(t, os.WriteFile(getStatePath(), []byte("{broken"), 0o644))
+	d := &mgrDaemon{sm: sm}
+	wc := watchdogConfig{AutoRestart: true}.withDefaults()
+
+	// the hung mount is still restarted
+	d.handleWatchdogVerdict(ctx, wc, "My_Drive", verdictUnhealthy, errMountHung)
+	n, err := sm.Restarts(ctx, "rclone@My_Drive.service")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), n)
+}